@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// tableSnapshot is the latest collected statistics of a table, as returned by
+// /api/v1/tables.
+type tableSnapshot struct {
+	Database    string    `json:"db"`
+	Schema      string    `json:"schema"`
+	Table       string    `json:"table"`
+	ParentTable string    `json:"parent_table,omitempty"`
+	Rows        float64   `json:"rows"`
+	Size        float64   `json:"size_bytes"`
+	HeapSize    float64   `json:"heap_size_bytes"`
+	ToastSize   float64   `json:"toast_size_bytes"`
+	IndexesSize float64   `json:"indexes_size_bytes"`
+	CollectedAt time.Time `json:"collected_at"`
+}
+
+// indexSnapshot is the latest collected statistics of an index, as returned
+// by /api/v1/indexes.
+type indexSnapshot struct {
+	Database    string    `json:"db"`
+	Schema      string    `json:"schema"`
+	Table       string    `json:"table"`
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Unique      bool      `json:"unique"`
+	Reads       float64   `json:"reads"`
+	Size        float64   `json:"size_bytes"`
+	CollectedAt time.Time `json:"collected_at"`
+}
+
+var (
+	snapshotMu sync.RWMutex
+	// tableSnapshots and indexSnapshots hold the latest statistics per
+	// database.
+	tableSnapshots = map[string][]tableSnapshot{}
+	indexSnapshots = map[string][]indexSnapshot{}
+)
+
+// setTableSnapshots replaces the tables of dbName once they have all been
+// collected, so that the API never serves a partial list.
+func setTableSnapshots(dbName string, tables []tableSnapshot) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	tableSnapshots[dbName] = tables
+}
+
+// setIndexSnapshots replaces the indexes of dbName once they have all been
+// collected.
+func setIndexSnapshots(dbName string, indexes []indexSnapshot) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	indexSnapshots[dbName] = indexes
+}
+
+// snapshotFilter is the filter given with the db, schema and table query
+// parameters. Empty fields match everything.
+type snapshotFilter struct {
+	database, schema, table string
+}
+
+func newSnapshotFilter(r *http.Request) snapshotFilter {
+	q := r.URL.Query()
+	return snapshotFilter{database: q.Get("db"), schema: q.Get("schema"), table: q.Get("table")}
+}
+
+func (f snapshotFilter) matches(database, schema, table string) bool {
+	return (f.database == "" || f.database == database) &&
+		(f.schema == "" || f.schema == schema) &&
+		(f.table == "" || f.table == table)
+}
+
+// writeJSON writes body as JSON with the given status code.
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+// writeJSONError writes a JSON error message with the given status code.
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, struct {
+		Error string `json:"error"`
+	}{message})
+}
+
+// tablesHandler serves the latest collected table statistics, optionally
+// filtered by db, schema and table, and sorted by name (the default), size
+// or rows. Sizes and row counts are sorted largest first.
+func tablesHandler(w http.ResponseWriter, r *http.Request) {
+	filter := newSnapshotFilter(r)
+
+	snapshotMu.RLock()
+	tables := []tableSnapshot{}
+	for _, snapshots := range tableSnapshots {
+		for _, table := range snapshots {
+			if filter.matches(table.Database, table.Schema, table.Table) {
+				tables = append(tables, table)
+			}
+		}
+	}
+	snapshotMu.RUnlock()
+
+	byName := func(i, j int) bool {
+		a, b := tables[i], tables[j]
+		if a.Database != b.Database {
+			return a.Database < b.Database
+		}
+		if a.Schema != b.Schema {
+			return a.Schema < b.Schema
+		}
+		return a.Table < b.Table
+	}
+
+	switch sortBy := r.URL.Query().Get("sort"); sortBy {
+	case "", "name":
+		sort.Slice(tables, byName)
+	case "size":
+		sort.Slice(tables, func(i, j int) bool { return tables[i].Size > tables[j].Size })
+	case "rows":
+		sort.Slice(tables, func(i, j int) bool { return tables[i].Rows > tables[j].Rows })
+	default:
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid sort %q, must be name, size or rows", sortBy))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Tables []tableSnapshot `json:"tables"`
+	}{tables})
+}
+
+// indexesHandler serves the latest collected index statistics, optionally
+// filtered by db, schema and table, and sorted by name (the default), size
+// or reads. Sizes and reads are sorted largest first.
+func indexesHandler(w http.ResponseWriter, r *http.Request) {
+	filter := newSnapshotFilter(r)
+
+	snapshotMu.RLock()
+	indexes := []indexSnapshot{}
+	for _, snapshots := range indexSnapshots {
+		for _, index := range snapshots {
+			if filter.matches(index.Database, index.Schema, index.Table) {
+				indexes = append(indexes, index)
+			}
+		}
+	}
+	snapshotMu.RUnlock()
+
+	byName := func(i, j int) bool {
+		a, b := indexes[i], indexes[j]
+		if a.Database != b.Database {
+			return a.Database < b.Database
+		}
+		if a.Schema != b.Schema {
+			return a.Schema < b.Schema
+		}
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		return a.Name < b.Name
+	}
+
+	switch sortBy := r.URL.Query().Get("sort"); sortBy {
+	case "", "name":
+		sort.Slice(indexes, byName)
+	case "size":
+		sort.Slice(indexes, func(i, j int) bool { return indexes[i].Size > indexes[j].Size })
+	case "reads":
+		sort.Slice(indexes, func(i, j int) bool { return indexes[i].Reads > indexes[j].Reads })
+	default:
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid sort %q, must be name, size or reads", sortBy))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Indexes []indexSnapshot `json:"indexes"`
+	}{indexes})
+}
@@ -1,51 +1,254 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 func queryTables(db DB, dbName string) (RowScanner, error) {
-	_, err := db.Exec(`USE $1`, dbName)
-	if err != nil {
-		return nil, err
-	}
-
-	return db.Query(`
+	// The catalogs are qualified with the database rather than selected with
+	// USE, since the pooled connection the query runs on may have a
+	// different current database.
+	//
+	// CockroachDB stores table data in the primary index and has no TOAST,
+	// so the heap size is the size of the primary index ranges. PARTITION BY
+	// partitions live inside the table's indexes rather than in tables of
+	// their own, so there is never a parent table.
+	return db.Query(fmt.Sprintf(`
 	SELECT
 		size.namespace,
 		size.table_name,
 		size.size AS size,
-		rows.rows AS rows
+		rows.rows AS rows,
+		size.heap_size AS heap_size,
+		0 AS toast_size,
+		size.size - size.heap_size AS indexes_size,
+		'' AS parent_table
 	FROM
-		(SELECT schema_name AS namespace, table_name, SUM(range_size) AS size
-			FROM crdb_internal.ranges
-			WHERE database_name = $1
-			GROUP BY namespace, table_name) AS size
+		(SELECT r.schema_name AS namespace, r.table_name,
+				SUM(r.range_size) AS size,
+				SUM(CASE WHEN ti.index_type = 'primary' THEN r.range_size ELSE 0 END) AS heap_size
+			FROM crdb_internal.ranges AS r
+			LEFT JOIN %[1]s.crdb_internal.table_indexes AS ti
+				ON r.table_id = ti.descriptor_id AND r.index_name = ti.index_name
+			WHERE r.database_name = $1
+			GROUP BY namespace, r.table_name) AS size
 	LEFT JOIN
 		(SELECT stats.table_name,
 			pg_namespace.nspname AS namespace,
 			stats.estimated_row_count AS rows
-		FROM crdb_internal.table_row_statistics AS stats, pg_class, pg_namespace
+		FROM %[1]s.crdb_internal.table_row_statistics AS stats, %[1]s.pg_catalog.pg_class, %[1]s.pg_catalog.pg_namespace
 			WHERE pg_class.relnamespace=pg_namespace.oid
 				AND pg_class.oid=stats.table_id
 				AND nspname NOT IN ('crdb_internal', 'information_schema', 'pg_catalog', 'pg_extension')
 		) AS rows
 	ON size.namespace=rows.namespace AND size.table_name = rows.table_name
-`, dbName)
+`, dbName), dbName)
 }
 
 func queryIndices(db DB, dbName string) (RowScanner, error) {
 	stmt := fmt.Sprintf(`
 	SELECT t.schema_name, ti.descriptor_name as table_name,
 		   ti.index_name, ti.index_type,
-		   ti.is_unique, total_reads
+		   ti.is_unique, total_reads,
+		   COALESCE(r.size, 0) AS size
 	  FROM %[1]s.crdb_internal.index_usage_statistics us
 	  JOIN %[1]s.crdb_internal.table_indexes ti
 		ON us.index_id = ti.index_id
 	   AND us.table_id = ti.descriptor_id
 	  JOIN %[1]s.crdb_internal.tables t
-		ON ti.descriptor_id = t.table_id;`, dbName)
+		ON ti.descriptor_id = t.table_id
+	  LEFT JOIN (SELECT table_id, index_name, SUM(range_size) AS size
+				   FROM crdb_internal.ranges
+				  WHERE database_name = '%[1]s'
+				  GROUP BY table_id, index_name) r
+		ON r.table_id = ti.descriptor_id
+	   AND r.index_name = ti.index_name;`, dbName)
+	return db.Query(stmt)
+}
+
+// queryLocks returns, per table, the number of lock requests waiting to be
+// granted, the longest wait and the depth of the longest chain of
+// transactions blocking a waiter.
+func queryLocks(db DB, dbName string) (RowScanner, error) {
+	return db.Query(`
+	WITH RECURSIVE waits AS (
+		SELECT DISTINCT w.txn_id AS waiter, h.txn_id AS holder
+		  FROM crdb_internal.cluster_locks w
+		  JOIN crdb_internal.cluster_locks h
+			ON h.lock_key = w.lock_key
+		   AND h.granted
+		   AND h.txn_id != w.txn_id
+		 WHERE NOT w.granted
+	), chain(origin, txn_id, depth) AS (
+		SELECT DISTINCT waiter, waiter, 0 FROM waits
+		UNION ALL
+		SELECT c.origin, w.holder, c.depth + 1
+		  FROM chain c
+		  JOIN waits w ON w.waiter = c.txn_id
+		 WHERE c.depth < 100
+	), depths AS (
+		SELECT origin AS txn_id, max(depth) AS depth
+		  FROM chain
+		 GROUP BY origin
+	)
+	SELECT l.schema_name, l.table_name,
+		   count(*) AS waiting,
+		   COALESCE(max(EXTRACT(EPOCH FROM l.duration)), 0) AS max_wait_seconds,
+		   COALESCE(max(d.depth), 0) AS max_chain_depth
+	  FROM crdb_internal.cluster_locks l
+	  LEFT JOIN depths d ON d.txn_id = l.txn_id
+	 WHERE NOT l.granted
+	   AND l.database_name = $1
+	 GROUP BY l.schema_name, l.table_name;
+`, dbName)
+}
+
+// queryIndexProblems returns indexes left behind by schema changes that
+// failed to revert, exact duplicates of another index and non-unique indexes
+// whose key columns are a prefix of a wider index, together with the index
+// that makes them duplicate or redundant and their size. Of two duplicates,
+// the primary index is kept over a unique index and a unique index over a
+// plain one; otherwise the newer is reported. The size of an invalid index is
+// unknown and returned as NULL.
+func queryIndexProblems(db DB, dbName string) (RowScanner, error) {
+	stmt := fmt.Sprintf(`
+	WITH keys AS (
+		SELECT table_schema, table_name, index_name,
+			   string_agg(column_name || ' ' || collation, ', ' ORDER BY seq_in_index) AS key_columns
+		  FROM %[1]s.information_schema.statistics
+		 WHERE storing = 'NO' AND implicit = 'NO'
+		 GROUP BY table_schema, table_name, index_name
+	), idx AS (
+		SELECT t.schema_name, t.name AS table_name, ti.index_name, ti.index_type,
+			   ti.is_unique, ti.descriptor_id, ti.index_id, k.key_columns,
+			   (ti.index_type = 'primary')::INT + ti.is_unique::INT AS keep_rank,
+			   COALESCE(substring(pi.indexdef FROM ' WHERE (.*)$'), '') AS predicate,
+			   COALESCE(r.size, 0) AS size
+		  FROM %[1]s.crdb_internal.table_indexes ti
+		  JOIN %[1]s.crdb_internal.tables t
+			ON t.table_id = ti.descriptor_id
+		  JOIN keys k
+			ON k.table_schema = t.schema_name
+		   AND k.table_name = t.name
+		   AND k.index_name = ti.index_name
+		  LEFT JOIN %[1]s.pg_catalog.pg_indexes pi
+			ON pi.schemaname = t.schema_name
+		   AND pi.tablename = t.name
+		   AND pi.indexname = ti.index_name
+		  LEFT JOIN (SELECT table_id, index_name, SUM(range_size) AS size
+					   FROM crdb_internal.ranges
+					  WHERE database_name = '%[1]s'
+					  GROUP BY table_id, index_name) r
+			ON r.table_id = ti.descriptor_id
+		   AND r.index_name = ti.index_name
+		 WHERE t.database_name = '%[1]s'
+		   AND NOT ti.is_inverted
+	)
+	SELECT t.schema_name, t.name,
+		   COALESCE(substring(j.description FROM 'INDEX (?:IF NOT EXISTS )?([^ ]+) ON'), ''),
+		   'secondary',
+		   (j.description LIKE '%%UNIQUE INDEX%%')::STRING,
+		   'invalid', '', NULL::FLOAT
+	  FROM crdb_internal.jobs j
+	  JOIN %[1]s.crdb_internal.tables t
+		ON t.table_id = j.descriptor_ids[1]
+	 WHERE j.job_type = 'SCHEMA CHANGE'
+	   AND j.status = 'revert-failed'
+	   AND j.description LIKE '%%INDEX%%'
+	   AND t.database_name = '%[1]s'
+	UNION ALL
+	SELECT a.schema_name, a.table_name, a.index_name, a.index_type, a.is_unique::STRING,
+		   'duplicate', b.index_name, a.size
+	  FROM idx a
+	  JOIN idx b
+		ON a.descriptor_id = b.descriptor_id
+	   AND (a.keep_rank < b.keep_rank OR (a.keep_rank = b.keep_rank AND a.index_id > b.index_id))
+	   AND a.key_columns = b.key_columns
+	   AND a.predicate = b.predicate
+	UNION ALL
+	SELECT a.schema_name, a.table_name, a.index_name, a.index_type, a.is_unique::STRING,
+		   'redundant', b.index_name, a.size
+	  FROM idx a
+	  JOIN idx b
+		ON a.descriptor_id = b.descriptor_id
+	   AND a.index_id != b.index_id
+	   AND NOT a.is_unique
+	   AND a.predicate = b.predicate
+	   AND left(b.key_columns, length(a.key_columns) + 2) = a.key_columns || ', ';`, dbName)
 	return db.Query(stmt)
 }
+
+// querySequences returns the current value, maximum value and used fraction
+// of every sequence, and for sequences used as a column default how much of
+// the column type's range has been used. CockroachDB has no catalog view with
+// the current values, so every sequence is read individually. Column defaults
+// must call nextval with the schema-qualified name of the sequence, or its
+// bare name for a column in the same schema.
+func querySequences(db DB, dbName string) (RowScanner, error) {
+	rows, err := db.Query(fmt.Sprintf(`
+	SELECT sequence_schema, sequence_name
+	  FROM %[1]s.information_schema.sequences;`, dbName))
+	if err != nil {
+		return nil, err
+	}
+
+	var currentValues []string
+	for rows.Next() {
+		var schema, name string
+		if err := rows.Scan(&schema, &name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		currentValues = append(currentValues, fmt.Sprintf(
+			`SELECT %s AS sequence_schema, %s AS sequence_name, last_value FROM %s.%s.%s`,
+			pq.QuoteLiteral(schema), pq.QuoteLiteral(name),
+			pq.QuoteIdentifier(dbName), pq.QuoteIdentifier(schema), pq.QuoteIdentifier(name)))
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(currentValues) == 0 {
+		return nil, nil
+	}
+
+	return db.Query(fmt.Sprintf(`
+	SELECT s.sequence_schema, s.sequence_name,
+		   v.last_value AS current_value,
+		   s.maximum_value::INT8 AS max_value,
+		   COALESCE(CASE
+			   WHEN s.increment::INT8 > 0
+			   THEN (v.last_value::DECIMAL - s.minimum_value::DECIMAL) / NULLIF(s.maximum_value::DECIMAL - s.minimum_value::DECIMAL, 0)
+			   ELSE (s.maximum_value::DECIMAL - v.last_value::DECIMAL) / NULLIF(s.maximum_value::DECIMAL - s.minimum_value::DECIMAL, 0)
+		   END, 0)::FLOAT8 AS used_ratio,
+		   COALESCE(c.table_schema, '') AS table_schema,
+		   COALESCE(c.table_name, '') AS table_name,
+		   COALESCE(c.column_name, '') AS column_name,
+		   CASE c.data_type
+			   WHEN 'smallint' THEN abs(v.last_value)::FLOAT8 / 32767
+			   WHEN 'integer' THEN abs(v.last_value)::FLOAT8 / 2147483647
+			   WHEN 'bigint' THEN abs(v.last_value)::FLOAT8 / 9223372036854775807
+			   ELSE 0
+		   END AS column_used_ratio
+	  FROM %[1]s.information_schema.sequences s
+	  JOIN (%[2]s) v
+		ON v.sequence_schema = s.sequence_schema
+	   AND v.sequence_name = s.sequence_name
+	  LEFT JOIN %[1]s.information_schema.columns c
+		ON c.column_default = 'nextval(' || quote_literal(quote_ident(s.sequence_schema) || '.' || quote_ident(s.sequence_name)) || '::REGCLASS)'
+		OR (c.table_schema = s.sequence_schema
+			AND c.column_default = 'nextval(' || quote_literal(quote_ident(s.sequence_name)) || '::REGCLASS)');`,
+		dbName, strings.Join(currentValues, " UNION ALL ")))
+}
+
+// queryExactRowCount counts the rows of a single table.
+func queryExactRowCount(ctx context.Context, tx Tx, dbName, schema, table string) (RowScanner, error) {
+	return tx.QueryContext(ctx, fmt.Sprintf(`SELECT count(*)::FLOAT8 FROM %s.%s.%s`,
+		pq.QuoteIdentifier(dbName), pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table)))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// collector is a named group of metrics refreshed together. Collectors can be
+// disabled with -collectors and -collectors_disabled, and selected per scrape
+// with collect[] URL parameters.
+type collector struct {
+	name   string
+	cache  *cache.Cache
+	update func(dbFactory DBFactory)
+}
+
+// collectors returns every collector. It is a function since the caches are
+// only created once the flags are parsed.
+func collectors() []collector {
+	return []collector{
+		{"tables", cacheMetrics, updateMetrics},
+		{"indexes", cacheIndices, updateIndicesMetrics},
+		{"partitioned_tables", cacheMetrics, updatePartitionedTablesMetrics},
+		{"table_stats", cacheMetrics, updateTableStatsMetrics},
+		{"table_io", cacheMetrics, updateTableIOMetrics},
+		{"index_io", cacheIndices, updateIndexIOMetrics},
+		{"index_problems", cacheIndices, updateIndexProblemsMetrics},
+		{"sequences", cacheMetrics, updateSequencesMetrics},
+		{"database_stats", cacheMetrics, updateDatabaseStatsMetrics},
+		{"database_wraparound", cacheMetrics, updateDatabaseWraparoundMetrics},
+		{"statements", cacheMetrics, updateStatementsMetrics},
+		{"replication", cacheMetrics, updateReplicationMetrics},
+		{"replication_slots", cacheMetrics, updateReplicationSlotsMetrics},
+		{"recovery", cacheMetrics, updateRecoveryMetrics},
+		{"server_stats", cacheMetrics, updateServerStatsMetrics},
+		{"activity", cacheMetrics, updateActivityMetrics},
+		{"io", cacheMetrics, updateIOMetrics},
+		{"locks", cacheMetrics, updateLocksMetrics},
+		{"exact_rows", cacheExactRows, updateExactRowsMetrics},
+		{"table_bloat", cacheBloat, updateTableBloatMetrics},
+		{"index_bloat", cacheBloat, updateIndexBloatMetrics},
+	}
+}
+
+// splitCollectorNames splits a comma-separated list of collector names,
+// returning an error for names that are not collectors.
+func splitCollectorNames(names string) ([]string, error) {
+	var split []string
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if _, ok := collectorMetrics[name]; !ok {
+			return nil, fmt.Errorf("unknown collector %q", name)
+		}
+		split = append(split, name)
+	}
+	return split, nil
+}
+
+// collectorEnabled reports whether the collector is enabled by -collectors
+// and -collectors_disabled. The flags are validated at startup.
+func collectorEnabled(name string) bool {
+	enabled, _ := splitCollectorNames(Config.collectors)
+	disabled, _ := splitCollectorNames(Config.collectorsDisabled)
+	for _, d := range disabled {
+		if d == name {
+			return false
+		}
+	}
+	if len(enabled) == 0 {
+		return true
+	}
+	for _, e := range enabled {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+// selectCollectors returns the enabled collectors named in names, or every
+// enabled collector if names is empty.
+func selectCollectors(names []string) ([]collector, error) {
+	selected := map[string]bool{}
+	for _, name := range names {
+		if _, ok := collectorMetrics[name]; !ok {
+			return nil, fmt.Errorf("unknown collector %q", name)
+		}
+		if !collectorEnabled(name) {
+			return nil, fmt.Errorf("collector %q is disabled", name)
+		}
+		selected[name] = true
+	}
+
+	var result []collector
+	for _, c := range collectors() {
+		if collectorEnabled(c.name) && (len(names) == 0 || selected[c.name]) {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+// updateCollectors refreshes the collectors whose cached metrics have
+// expired. They are refreshed concurrently, so that a scrape waits for at
+// most one -stale_read_threshold rather than one per collector.
+func updateCollectors(dbFactory DBFactory, selected []collector) {
+	var wg sync.WaitGroup
+	for _, c := range selected {
+		if _, found := c.cache.Get(c.name); !found {
+			wg.Add(1)
+			go func(c collector) {
+				defer wg.Done()
+				c.update(dbFactory)
+			}(c)
+		}
+	}
+	wg.Wait()
+}
+
+// metricsHandler refreshes the expired collectors and serves their metrics.
+// With collect[] URL parameters, only the named collectors are refreshed
+// and served.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	names := r.URL.Query()["collect[]"]
+
+	configMu.RLock()
+	selected, err := selectCollectors(names)
+	configMu.RUnlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updateCollectors(dbPool, selected)
+
+	if len(names) == 0 {
+		promhttp.Handler().ServeHTTP(w, r)
+	} else {
+		registry := prometheus.NewRegistry()
+		for _, c := range selected {
+			for _, metric := range collectorMetrics[c.name] {
+				registry.MustRegister(&freshnessCollector{Collector: metric, key: c.name})
+			}
+		}
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+	checkRequests()
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configMu guards the settings that can be reloaded. It is only held while
+// reading or writing them, never while querying the database; refreshes work
+// on a copy taken with currentConfig. Settings that require a restart are
+// never written after startup, and are read without it.
+var configMu sync.RWMutex
+
+// currentConfig returns a copy of the current settings.
+func currentConfig() config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return Config
+}
+
+// reloadableFlags are the flags a reload applies. Changing any other flag in
+// the configuration file requires a restart.
+var reloadableFlags = map[string]bool{
+	"collect_bloat":             true,
+	"collectors":                true,
+	"collectors_disabled":       true,
+	"exact_rows_max_estimate":   true,
+	"exact_rows_sample_percent": true,
+	"exact_rows_tables":         true,
+	"exact_rows_timeout":        true,
+	"max_staleness":             true,
+	"partition_rollup":          true,
+	"sample_timestamps":         true,
+	"stale_read_threshold":      true,
+	"statements_limit":          true,
+	"unready_after":             true,
+}
+
+// validateConfig checks the settings that cannot be checked by the flag
+// package itself.
+func validateConfig() error {
+	for _, dbName := range databaseNames() {
+		if _, err := sanitizeIdentifier(dbName); err != nil {
+			return fmt.Errorf("invalid database name: %w", err)
+		}
+	}
+
+	if Config.dbType != "cockroachdb" && Config.dbType != "postgres" {
+		return errors.New("invalid database type. Must be 'cockroachdb' or 'postgres'")
+	}
+
+	if _, err := splitCollectorNames(Config.collectors); err != nil {
+		return fmt.Errorf("invalid collectors: %w", err)
+	}
+	if _, err := splitCollectorNames(Config.collectorsDisabled); err != nil {
+		return fmt.Errorf("invalid disabled collectors: %w", err)
+	}
+
+	if Config.exactRowsSample < 0 || Config.exactRowsSample > 100 {
+		return errors.New("invalid exact rows sample percentage. Must be between 0 and 100")
+	}
+	if Config.exactRowsSample > 0 && Config.dbType != "postgres" {
+		return errors.New("sampled row counts are only supported on 'postgres'")
+	}
+	return nil
+}
+
+// applyConfigFile sets the flags named in the YAML configuration file at
+// path, except those set on the command line, which take precedence. When
+// reloading, flags that require a restart are left unchanged, and reloadable
+// flags no longer in the file revert to their defaults. If the resulting
+// configuration is invalid, every flag is restored.
+func applyConfigFile(path string, reloading bool) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	commandLine := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		commandLine[f.Name] = true
+	})
+
+	previous := map[string]string{}
+	restore := func() {
+		for name, value := range previous {
+			flag.Lookup(name).Value.Set(value)
+		}
+	}
+
+	if reloading {
+		for name := range reloadableFlags {
+			f := flag.Lookup(name)
+			if f == nil || commandLine[name] {
+				continue
+			}
+			previous[name] = f.Value.String()
+			if err := f.Value.Set(f.DefValue); err != nil {
+				restore()
+				return fmt.Errorf("resetting %s: %w", name, err)
+			}
+		}
+	}
+
+	for name, value := range values {
+		f := flag.Lookup(name)
+		if f == nil || name == "config_file" {
+			restore()
+			return fmt.Errorf("unknown setting %q in %s", name, path)
+		}
+		if commandLine[name] {
+			continue
+		}
+
+		// Lists are accepted for the comma-separated flags.
+		str := fmt.Sprint(value)
+		if list, ok := value.([]interface{}); ok {
+			items := make([]string, len(list))
+			for i, item := range list {
+				items[i] = fmt.Sprint(item)
+			}
+			str = strings.Join(items, ",")
+		}
+
+		if reloading && !reloadableFlags[name] {
+			if str != f.Value.String() {
+				log.Printf("Changing %s requires a restart, ignoring it\n", name)
+			}
+			continue
+		}
+
+		if _, ok := previous[name]; !ok {
+			previous[name] = f.Value.String()
+		}
+		if err := f.Value.Set(str); err != nil {
+			restore()
+			return fmt.Errorf("invalid %s in %s: %w", name, path, err)
+		}
+	}
+
+	if err := validateConfig(); err != nil {
+		restore()
+		return err
+	}
+	return nil
+}
+
+// reloadConfig applies the configuration file again, and expires every
+// cache so that the new settings take effect on the next scrape.
+func reloadConfig() error {
+	if Config.configFile == "" {
+		return errors.New("no configuration file given with -config_file")
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	if err := applyConfigFile(Config.configFile, true); err != nil {
+		return err
+	}
+
+	cacheMetrics.Flush()
+	cacheIndices.Flush()
+	cacheBloat.Flush()
+	cacheExactRows.Flush()
+	log.Println("Reloaded configuration from", Config.configFile)
+	return nil
+}
+
+// reloadHandler reloads the configuration file on POST requests, if
+// -enable_lifecycle is set.
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if !Config.enableLifecycle {
+		writeJSONError(w, http.StatusForbidden, "lifecycle API is not enabled")
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "reloading requires a POST request")
+		return
+	}
+
+	if err := reloadConfig(); err != nil {
+		log.Println("Failed to reload configuration:", err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Status string `json:"status"`
+	}{"reloaded"})
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"reflect"
+	"strings"
+	"sync"
 )
 
 // DB interface includes methods required for your database operations.
@@ -13,6 +16,16 @@ type DB interface {
 	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 	Query(query string, args ...interface{}) (RowScanner, error)
 	QueryContext(ctx context.Context, query string, args ...interface{}) (RowScanner, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error)
+	PingContext(ctx context.Context) error
+}
+
+// Tx is a transaction started with DB.BeginTx.
+type Tx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (RowScanner, error)
+	Commit() error
+	Rollback() error
 }
 
 // SqlDB wraps a sql.DB and implements DB.
@@ -36,6 +49,27 @@ func (db *SqlDB) QueryContext(ctx context.Context, query string, args ...interfa
 	return &SqlRows{rows}, nil
 }
 
+func (db *SqlDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &SqlTx{tx}, nil
+}
+
+// SqlTx wraps sql.Tx and implements Tx.
+type SqlTx struct {
+	*sql.Tx
+}
+
+func (tx *SqlTx) QueryContext(ctx context.Context, query string, args ...interface{}) (RowScanner, error) {
+	rows, err := tx.Tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &SqlRows{rows}, nil
+}
+
 // SqlRows wraps sql.Rows and implements RowScanner.
 type SqlRows struct {
 	*sql.Rows
@@ -57,6 +91,86 @@ func (f *SqlDBFactory) New(connStr string) (DB, error) {
 	return &SqlDB{db}, nil
 }
 
+// PooledDBFactory keeps one DB per connection string, so that refreshes of the
+// same database share a connection pool instead of opening a new one each
+// time.
+type PooledDBFactory struct {
+	factory DBFactory
+	mu      sync.Mutex
+	dbs     map[string]DB
+	closed  bool
+	// ctx is cancelled on Close, cancelling the queries run without a
+	// context of their own.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (f *PooledDBFactory) New(connStr string) (DB, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, errors.New("connection pool is closed")
+	}
+	if f.ctx == nil {
+		f.ctx, f.cancel = context.WithCancel(context.Background())
+	}
+
+	if db, ok := f.dbs[connStr]; ok {
+		return &pooledDB{db, f.ctx}, nil
+	}
+
+	db, err := f.factory.New(connStr)
+	if err != nil {
+		return nil, err
+	}
+	if f.dbs == nil {
+		f.dbs = make(map[string]DB)
+	}
+	f.dbs[connStr] = db
+	return &pooledDB{db, f.ctx}, nil
+}
+
+// Close cancels running queries and closes every pooled DB. No DB can be
+// created afterwards.
+func (f *PooledDBFactory) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	if f.cancel != nil {
+		f.cancel()
+	}
+
+	var firstErr error
+	for connStr, db := range f.dbs {
+		if err := db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(f.dbs, connStr)
+	}
+	return firstErr
+}
+
+// pooledDB is a DB handed out by PooledDBFactory. Closing it returns it to
+// the pool rather than closing it.
+type pooledDB struct {
+	DB
+	ctx context.Context
+}
+
+func (p *pooledDB) Close() error {
+	return nil
+}
+
+func (p *pooledDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return p.DB.ExecContext(p.ctx, query, args...)
+}
+
+func (p *pooledDB) Query(query string, args ...interface{}) (RowScanner, error) {
+	return p.DB.QueryContext(p.ctx, query, args...)
+}
+
 // MockDBFactory creates mock DB instances.
 type MockDBFactory struct {
 	openError error
@@ -95,6 +209,36 @@ func (m *MockDB) QueryContext(ctx context.Context, query string, args ...interfa
 	return m.conn.QueryContext(ctx, query, args...)
 }
 
+func (m *MockDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	return &MockTx{conn: m.conn}, nil
+}
+
+func (m *MockDB) PingContext(ctx context.Context) error {
+	return m.conn.pingError
+}
+
+// MockTx holds the mock implementation of Tx for testing. Statements run on
+// the connection of the MockDB it was started on.
+type MockTx struct {
+	conn *MockSQLConn
+}
+
+func (m *MockTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return m.conn.ExecContext(ctx, query, args...)
+}
+
+func (m *MockTx) QueryContext(ctx context.Context, query string, args ...interface{}) (RowScanner, error) {
+	return m.conn.QueryContext(ctx, query, args...)
+}
+
+func (m *MockTx) Commit() error {
+	return nil
+}
+
+func (m *MockTx) Rollback() error {
+	return nil
+}
+
 // RowScanner interface includes methods for scanning rows of a result.
 type RowScanner interface {
 	Close() error
@@ -107,7 +251,21 @@ type RowScanner interface {
 type MockSQLConn struct {
 	execError  error
 	queryError error
+	pingError  error
 	rows       RowScanner
+	// database is the name reported by current_database(). It defaults to
+	// the database asked for.
+	database string
+	// queryRows holds rows returned instead of rows for queries containing
+	// a substring, for code paths that run more than one query. The first
+	// matching substring wins.
+	queryRows []mockQuery
+}
+
+// mockQuery is the result MockSQLConn returns for queries containing substr.
+type mockQuery struct {
+	substr string
+	rows   RowScanner
 }
 
 func (m *MockSQLConn) Close() error {
@@ -122,6 +280,18 @@ func (m *MockSQLConn) QueryContext(ctx context.Context, query string, args ...in
 	if m.queryError != nil {
 		return nil, m.queryError
 	}
+	if strings.Contains(query, "current_database() = $1") {
+		database := m.database
+		if database == "" {
+			database = args[0].(string)
+		}
+		return &MockSQLRows{data: [][]interface{}{{database == args[0], database}}}, nil
+	}
+	for _, q := range m.queryRows {
+		if strings.Contains(query, q.substr) {
+			return q.rows, nil
+		}
+	}
 	return m.rows, nil
 }
 
@@ -139,8 +309,8 @@ func (m *MockSQLRows) Scan(dest ...interface{}) error {
 		return m.scanError
 	}
 
-	if m.current < len(m.data) {
-		row := m.data[m.current]
+	if m.current > 0 && m.current <= len(m.data) {
+		row := m.data[m.current-1]
 		for i, v := range row {
 			val := reflect.ValueOf(v)
 			if val.Kind() == reflect.Ptr {
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// collectorStatus is the outcome of the latest refreshes of a collector.
+type collectorStatus struct {
+	LastSuccess   *time.Time `json:"last_success,omitempty"`
+	LastDuration  float64    `json:"last_duration_seconds"`
+	LastRows      int        `json:"last_rows"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+// healthStatus is the JSON body of the health and readiness endpoints.
+type healthStatus struct {
+	Status           string                      `json:"status"`
+	UnreachableSince *time.Time                  `json:"database_unreachable_since,omitempty"`
+	Collectors       map[string]*collectorStatus `json:"collectors"`
+}
+
+var (
+	statusMu          sync.Mutex
+	collectorStatuses = map[string]*collectorStatus{}
+	// refreshTimes holds the time of the last successful refresh of every
+	// collector, by name and database.
+	refreshTimes = map[string]map[string]time.Time{}
+	// refreshed is set once any collector has refreshed successfully.
+	refreshed bool
+	// unreachableSince is when the database became unreachable, or zero if
+	// the latest attempt to reach it succeeded.
+	unreachableSince time.Time
+	// backgroundRefreshing guards against starting more than one background
+	// refresh at a time.
+	backgroundRefreshing int32
+)
+
+// recordRefreshSuccess records that the collector named key has refreshed
+// successfully from database dbName, taking duration and returning rowCount
+// rows, which also proves the database reachable.
+func recordRefreshSuccess(key, dbName string, duration time.Duration, rowCount int) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	now := time.Now()
+	status := statusOf(key)
+	status.LastSuccess = &now
+	status.LastDuration = duration.Seconds()
+	status.LastRows = rowCount
+	if refreshTimes[key] == nil {
+		refreshTimes[key] = map[string]time.Time{}
+	}
+	refreshTimes[key][dbName] = now
+	refreshed = true
+	unreachableSince = time.Time{}
+
+	lastRefreshGauge.WithLabelValues(dbName, key).Set(float64(now.Unix()))
+}
+
+// recordRefreshError records that refreshing the collector named key from
+// database dbName failed. Connection failures mark the database
+// unreachable; errors reported by the server itself do not.
+func recordRefreshError(key, dbName string, err error, connecting bool) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	now := time.Now()
+	status := statusOf(key)
+	status.LastError = fmt.Sprintf("%s: %v", dbName, err)
+	status.LastErrorTime = &now
+
+	var serverErr *pq.Error
+	if connecting && !errors.As(err, &serverErr) && unreachableSince.IsZero() {
+		unreachableSince = now
+	}
+}
+
+// lastRefresh returns when the collector named key last refreshed successfully
+// from database dbName, or from any database if it has never been refreshed
+// from dbName. Server-wide collectors label their metrics with
+// databases they are not refreshed from.
+func lastRefresh(key, dbName string) time.Time {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	if t, ok := refreshTimes[key][dbName]; ok {
+		return t
+	}
+	if status, ok := collectorStatuses[key]; ok && status.LastSuccess != nil {
+		return *status.LastSuccess
+	}
+	return time.Time{}
+}
+
+// statusOf returns the status of the collector named key. statusMu must be
+// held.
+func statusOf(key string) *collectorStatus {
+	status, ok := collectorStatuses[key]
+	if !ok {
+		status = &collectorStatus{}
+		collectorStatuses[key] = status
+	}
+	return status
+}
+
+// pingDatabase checks that the database is reachable and records the
+// outcome: a failure marks it unreachable unless it already was, and a
+// success clears the mark.
+func pingDatabase(dbFactory DBFactory) {
+	err := func() error {
+		db, err := openDatabase(dbFactory, serverDatabase())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), currentConfig().staleReadThreshold)
+		defer cancel()
+		return db.PingContext(ctx)
+	}()
+
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	if err == nil {
+		unreachableSince = time.Time{}
+	} else if unreachableSince.IsZero() {
+		unreachableSince = time.Now()
+	}
+}
+
+// isReady reports whether a collector has refreshed successfully and the
+// database has not been unreachable for longer than Config.unreadyAfter.
+func isReady() bool {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	return refreshed && (unreachableSince.IsZero() || time.Since(unreachableSince) <= Config.unreadyAfter)
+}
+
+// currentHealthStatus returns a copy of the current collector statuses.
+func currentHealthStatus(status string) healthStatus {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	body := healthStatus{
+		Status:     status,
+		Collectors: make(map[string]*collectorStatus, len(collectorStatuses)),
+	}
+	if !unreachableSince.IsZero() {
+		since := unreachableSince
+		body.UnreachableSince = &since
+	}
+	for key, collector := range collectorStatuses {
+		copied := *collector
+		body.Collectors[key] = &copied
+	}
+	return body
+}
+
+// writeHealthStatus writes the current collector statuses as JSON.
+func writeHealthStatus(w http.ResponseWriter, code int, status string) {
+	writeJSON(w, code, currentHealthStatus(status))
+}
+
+// healthyHandler reports that the process is alive. It does not depend on
+// the database.
+func healthyHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealthStatus(w, http.StatusOK, "healthy")
+}
+
+// readyHandler reports whether rowdy is serving metrics read from a
+// reachable database, pinging it rather than waiting for collectors to
+// expire. While unready, it starts a background refresh so that readiness
+// recovers without waiting for a scrape.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	pingDatabase(dbPool)
+	if isReady() {
+		writeHealthStatus(w, http.StatusOK, "ready")
+		return
+	}
+
+	refreshInBackground(dbPool)
+	writeHealthStatus(w, http.StatusServiceUnavailable, "unready")
+}
+
+// refreshInBackground refreshes every enabled, expired collector in a
+// background goroutine, unless such a refresh is already running.
+func refreshInBackground(dbFactory DBFactory) {
+	if !atomic.CompareAndSwapInt32(&backgroundRefreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&backgroundRefreshing, 0)
+		configMu.RLock()
+		selected, _ := selectCollectors(nil)
+		configMu.RUnlock()
+		updateCollectors(dbFactory, selected)
+	}()
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// landingPageTemplate renders the page served on /, to help finding out why
+// metrics are missing without access to the logs.
+var landingPageTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Rowdy</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+td.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Rowdy</h1>
+<p>CockroachDB/PostgreSQL table rows/size &amp; index statistics exporter for Prometheus.</p>
+<ul>
+<li><a href="metrics">Metrics</a></li>
+<li><a href="-/healthy">Health</a></li>
+<li><a href="-/ready">Readiness</a> ({{.Status}})</li>
+</ul>
+<table>
+<tr><th>Version</th><td>{{.Version}}</td></tr>
+<tr><th>Commit</th><td>{{.Commit}}</td></tr>
+<tr><th>Database</th><td>{{.Database}}</td></tr>
+<tr><th>Database type</th><td>{{.DatabaseType}}</td></tr>
+{{- if .UnreachableSince}}
+<tr><th>Unreachable since</th><td class="error">{{.UnreachableSince}}</td></tr>
+{{- end}}
+</table>
+<h2>Collectors</h2>
+<table>
+<tr><th>Collector</th><th>Last refresh</th><th>Duration</th><th>Rows</th><th>Last error</th></tr>
+{{- range .Collectors}}
+<tr>
+<td>{{.Name}}</td>
+<td>{{.LastSuccess}}</td>
+<td>{{.Duration}}</td>
+<td>{{.Rows}}</td>
+<td class="error">{{if .LastError}}{{.LastError}} ({{.LastErrorTime}}){{end}}</td>
+</tr>
+{{- else}}
+<tr><td colspan="5">No collector has been refreshed yet.</td></tr>
+{{- end}}
+</table>
+<h2>Configuration</h2>
+<table>
+{{- range .Flags}}
+<tr><th>-{{.Name}}</th><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// landingPageCollector is a row of the collector table on the landing page.
+type landingPageCollector struct {
+	Name          string
+	LastSuccess   string
+	Duration      string
+	Rows          int
+	LastError     string
+	LastErrorTime string
+}
+
+// landingPageFlag is a row of the configuration table on the landing page.
+type landingPageFlag struct {
+	Name  string
+	Value string
+}
+
+// passwordPattern matches the password of a key/value connection string.
+var passwordPattern = regexp.MustCompile(`(password\s*=\s*)('(\\.|[^'])*'|\S+)`)
+
+// redactConnStr replaces the password in connStr, in either URL or key/value
+// form.
+func redactConnStr(connStr string) string {
+	if u, err := url.Parse(connStr); err == nil && u.Scheme != "" {
+		if q := u.Query(); q.Has("password") {
+			q.Set("password", "xxxxx")
+			u.RawQuery = q.Encode()
+		}
+		return u.Redacted()
+	}
+	return passwordPattern.ReplaceAllString(connStr, "${1}xxxxx")
+}
+
+// formatTime formats t for the landing page, or returns "never".
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// landingHandler serves an HTML page with the version, target database,
+// collector statuses and effective configuration of rowdy.
+func landingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	status := "unready"
+	if isReady() {
+		status = "ready"
+	}
+	health := currentHealthStatus(status)
+
+	page := struct {
+		Version          string
+		Commit           string
+		Database         string
+		DatabaseType     string
+		Status           string
+		UnreachableSince string
+		Collectors       []landingPageCollector
+		Flags            []landingPageFlag
+	}{
+		Version:      gitTag,
+		Commit:       gitCommit,
+		Database:     Config.dbName,
+		DatabaseType: Config.dbType,
+		Status:       health.Status,
+	}
+	if health.UnreachableSince != nil {
+		page.UnreachableSince = formatTime(health.UnreachableSince)
+	}
+
+	for name, collector := range health.Collectors {
+		row := landingPageCollector{
+			Name:        name,
+			LastSuccess: formatTime(collector.LastSuccess),
+			Duration:    "-",
+			Rows:        collector.LastRows,
+			LastError:   collector.LastError,
+		}
+		if collector.LastSuccess != nil {
+			row.Duration = time.Duration(collector.LastDuration * float64(time.Second)).Round(time.Millisecond).String()
+		}
+		if collector.LastError != "" {
+			row.LastErrorTime = formatTime(collector.LastErrorTime)
+		}
+		page.Collectors = append(page.Collectors, row)
+	}
+	sort.Slice(page.Collectors, func(i, j int) bool {
+		return page.Collectors[i].Name < page.Collectors[j].Name
+	})
+
+	configMu.RLock()
+	defer configMu.RUnlock()
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if f.Name == "connstr" {
+			value = redactConnStr(value)
+		}
+		page.Flags = append(page.Flags, landingPageFlag{Name: f.Name, Value: value})
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := landingPageTemplate.Execute(w, page); err != nil {
+		log.Println("Failed to render landing page:", err)
+	}
+}
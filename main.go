@@ -2,47 +2,79 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
 	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
+	kitlog "github.com/go-kit/log"
 	_ "github.com/lib/pq"
 	"github.com/patrickmn/go-cache"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/exporter-toolkit/web"
 )
 
 type config struct {
 	cacheTTL           time.Duration
+	cacheTTLBloat      time.Duration
+	cacheTTLExactRows  time.Duration
 	cacheTTLIndices    time.Duration
+	collectBloat       bool
+	collectors         string
+	collectorsDisabled string
+	configFile         string
 	connStr            string
 	dbName             string
 	dbType             string
+	enableLifecycle    bool
+	exactRowsMax       float64
+	exactRowsSample    float64
+	exactRowsTables    string
+	exactRowsTimeout   time.Duration
 	listenAddress      string
-	requestCount       uint64
+	maxStaleness       time.Duration
+	partitionRollup    bool
 	requestLimit       int
+	sampleTimestamps   bool
 	staleReadThreshold time.Duration
+	statementsLimit    int
+	unreadyAfter       time.Duration
+	webConfigFile      string
 }
 
 var (
-	cacheIndices *cache.Cache
-	cacheMetrics *cache.Cache
-	Config       config
-	gitCommit    string
-	gitTag       string
-	server       *http.Server
+	cacheBloat     *cache.Cache
+	cacheExactRows *cache.Cache
+	cacheIndices   *cache.Cache
+	cacheMetrics   *cache.Cache
+	Config         config
+	dbPool         *PooledDBFactory
+	gitCommit      string
+	gitTag         string
+	requestCount   uint64
+	server         *http.Server
+	shutdownDone   = make(chan struct{})
+	shutdownOnce   sync.Once
 )
 
 func init() {
 	cacheMetrics = cache.New(time.Second, 10*time.Minute)
 	cacheIndices = cache.New(time.Second, 10*time.Minute)
-	Config.requestCount = 0
+	cacheBloat = cache.New(time.Second, 10*time.Minute)
+	cacheExactRows = cache.New(time.Second, 10*time.Minute)
+	dbPool = &PooledDBFactory{factory: &SqlDBFactory{}}
 }
 
 // Regex to match valid identifiers. Adjust as needed.
@@ -57,84 +89,211 @@ func sanitizeIdentifier(identifier string) (string, error) {
 
 func checkRequests() {
 	if Config.requestLimit > 0 {
-		requests := atomic.AddUint64(&Config.requestCount, 1)
+		requests := atomic.AddUint64(&requestCount, 1)
 		if int(requests) >= Config.requestLimit {
-			go func() {
-				if err := server.Shutdown(context.Background()); err != nil {
-					log.Fatalf("Could not gracefully shutdown the server: %v\n", err)
-				}
-			}()
+			go shutdown()
 		}
 	}
 }
 
-func updateIndicesMetrics(dbFactory DBFactory) {
+// databaseNames returns the databases named with -db, which takes a
+// comma-separated list.
+func databaseNames() []string {
+	var names []string
+	for _, name := range strings.Split(Config.dbName, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// forEachDatabase calls refreshDatabase once for every database named with
+// -db, for collectors whose statistics are local to a database. The
+// databases are refreshed concurrently, so that a scrape waits for at most
+// one -stale_read_threshold rather than one per database.
+func forEachDatabase(refreshDatabase func(dbName string)) {
 	var wg sync.WaitGroup
+	for _, dbName := range databaseNames() {
+		wg.Add(1)
+		go func(dbName string) {
+			defer wg.Done()
+			refreshDatabase(dbName)
+		}(dbName)
+	}
+	wg.Wait()
+}
+
+// serverDatabase returns the database used by collectors whose statistics
+// cover the whole server, which only need to be read once.
+func serverDatabase() string {
+	names := databaseNames()
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+// openDatabase connects to dbName. On PostgreSQL, where statistics are only
+// visible from within a database, the connection string is rewritten to
+// point at dbName and the connected database is verified, so that metrics
+// are never labelled with a database they were not read from.
+func openDatabase(dbFactory DBFactory, dbName string) (DB, error) {
+	if Config.dbType != "postgres" {
+		return dbFactory.New(Config.connStr)
+	}
+
+	connStr, err := connStrPostgreSQL(Config.connStr, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := dbFactory.New(connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkDatabasePostgreSQL(db, dbName); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// handleSignals shuts down gracefully on SIGINT and SIGTERM, and reloads the
+// configuration file on SIGHUP.
+func handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
-	ctx, cancel := context.WithTimeout(context.Background(), Config.staleReadThreshold)
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			if err := reloadConfig(); err != nil {
+				log.Println("Failed to reload configuration:", err)
+			}
+			continue
+		}
+
+		log.Printf("Received %s, shutting down.\n", sig)
+		shutdown()
+		return
+	}
+}
+
+// shutdown stops the server once the requests being served have finished,
+// waiting at most 10 seconds, and then cancels the queries still running in
+// the background and closes the connections. Only the first call shuts
+// down; shutdownDone is closed once it has finished.
+func shutdown() {
+	shutdownOnce.Do(func() {
+		defer close(shutdownDone)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println("Could not gracefully shutdown the server:", err)
+		}
+
+		if err := dbPool.Close(); err != nil {
+			log.Println("Failed to close connections:", err)
+		}
+	})
+}
+
+// refresh runs query against database dbName in a background goroutine and
+// hands every returned row to scan. If the query has not finished within Config.staleReadThreshold,
+// refresh returns early, marks the cache entry as fresh and lets the caller
+// serve stale metrics while the query completes in the background.
+func refresh(dbFactory DBFactory, dbName string, c *cache.Cache, key string, histogram prometheus.Observer,
+	query func(db DB) (RowScanner, error), scan func(rows RowScanner) error) {
+	// Create a context that will be cancelled if it takes more than staleReadThreshold
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().staleReadThreshold)
 	defer cancel()
 
 	start := time.Now()
-	doneChan := make(chan struct{})
 
+	// Use a WaitGroup to know when the goroutine finishes its execution
+	var wg sync.WaitGroup
 	wg.Add(1)
+
+	// This channel will receive a signal from the goroutine when the query is
+	// done. It is buffered so that a query finishing after a stale read does
+	// not block forever.
+	doneChan := make(chan struct{}, 1)
+
 	go func() {
 		defer wg.Done()
 		defer cancel()
 
-		db, err := dbFactory.New(Config.connStr)
+		// Only successful refreshes are cached. A failed one is retried on
+		// the next scrape instead of once the cache expires, including when
+		// it fails after a stale read was returned.
+		failed := true
+		defer func() {
+			if failed {
+				c.Delete(key)
+			} else {
+				c.Set(key, true, cache.DefaultExpiration)
+			}
+			doneChan <- struct{}{}
+		}()
+
+		db, err := openDatabase(dbFactory, dbName)
 		if err != nil {
 			log.Println("Failed to open connection:", err)
 			queryErrorsCounter.Inc()
+			recordRefreshError(key, dbName, err, true)
 			return
 		}
 		defer db.Close()
 
-		var rows RowScanner
-
-		switch Config.dbType {
-		case "cockroachdb":
-			rows, err = queryIndices(db, Config.dbName)
-		case "postgres":
-			rows, err = queryIndicesPostgreSQL(db, Config.dbName)
-		default:
-			panic(fmt.Sprintf("Assertion failed: Invalid database type: [%s]", Config.dbType))
-		}
-
+		rows, err := query(db)
 		if err != nil {
 			log.Println("Failed to execute query:", err)
 			queryErrorsCounter.Inc()
+			recordRefreshError(key, dbName, err, true)
 			return
 		}
-		defer rows.Close()
 
-		for rows.Next() {
-			var schema, table, indexName, indexType, indexUnique string
-			var numUsed float64
-			if err := rows.Scan(&schema, &table, &indexName, &indexType, &indexUnique, &numUsed); err != nil {
-				log.Println("Failed to scan row:", err)
+		failed = false
+		rowCount := 0
+
+		// A nil result means the statistics are unavailable on this server,
+		// which is not an error.
+		if rows != nil {
+			defer rows.Close()
+
+			for rows.Next() {
+				rowCount++
+				if err := scan(rows); err != nil {
+					log.Println("Failed to scan row:", err)
+					queryErrorsCounter.Inc()
+					recordRefreshError(key, dbName, err, false)
+					failed = true
+				}
+			}
+
+			if err := rows.Err(); err != nil {
+				log.Println("Error fetching rows:", err)
 				queryErrorsCounter.Inc()
-			} else {
-				indexReadCounter.WithLabelValues(Config.dbName, schema, table, indexName, indexType, indexUnique).Set(numUsed)
+				recordRefreshError(key, dbName, err, true)
+				failed = true
 			}
 		}
 
-		if err := rows.Err(); err != nil {
-			log.Println("Error fetching rows:", err)
-			queryErrorsCounter.Inc()
+		duration := time.Since(start)
+		if !failed {
+			recordRefreshSuccess(key, dbName, duration, rowCount)
 		}
-
-		queryHistogramIndices.Observe(time.Since(start).Seconds())
-		cacheIndices.Set("metricsIndices", true, cache.DefaultExpiration)
-		doneChan <- struct{}{}
+		histogram.Observe(duration.Seconds())
 	}()
 
 	// Wait for the signal from the goroutine or the context timeout
 	select {
 	case <-ctx.Done():
-		// If the context is done (it took more than 3 seconds),
+		// If the context is done (it took more than staleReadThreshold),
 		// update the cache timeout and return a stale read
-		cacheIndices.Set("metricsIndices", true, cache.DefaultExpiration)
+		c.Set(key, true, cache.DefaultExpiration)
 		queryStaleReadsCounter.Inc()
 		return
 	case <-doneChan:
@@ -145,105 +304,915 @@ func updateIndicesMetrics(dbFactory DBFactory) {
 	wg.Wait()
 }
 
+func updateIndicesMetrics(dbFactory DBFactory) {
+	forEachDatabase(func(dbName string) {
+		var collectedAt time.Time
+		var indexes []indexSnapshot
+		refresh(dbFactory, dbName, cacheIndices, "indexes", queryHistogramIndices, func(db DB) (RowScanner, error) {
+			var rows RowScanner
+			var err error
+
+			switch Config.dbType {
+			case "cockroachdb":
+				rows, err = queryIndices(db, dbName)
+			case "postgres":
+				rows, err = queryIndicesPostgreSQL(db, dbName)
+			default:
+				panic(fmt.Sprintf("Assertion failed: Invalid database type: [%s]", Config.dbType))
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			collectedAt = time.Now()
+			return &finishingRows{RowScanner: rows, finish: func(complete bool) {
+				if complete {
+					setIndexSnapshots(dbName, indexes)
+				}
+			}}, nil
+		}, func(rows RowScanner) error {
+			var schema, table, indexName, indexType, indexUnique string
+			var numUsed, size float64
+			if err := rows.Scan(&schema, &table, &indexName, &indexType, &indexUnique, &numUsed, &size); err != nil {
+				return err
+			}
+			indexReadCounter.WithLabelValues(dbName, schema, table, indexName, indexType, indexUnique).Set(numUsed)
+			indexSizeGauge.WithLabelValues(dbName, schema, table, indexName, indexType, indexUnique).Set(size)
+			indexes = append(indexes, indexSnapshot{
+				Database:    dbName,
+				Schema:      schema,
+				Table:       table,
+				Name:        indexName,
+				Type:        indexType,
+				Unique:      indexUnique == "true",
+				Reads:       numUsed,
+				Size:        size,
+				CollectedAt: collectedAt,
+			})
+			return nil
+		})
+	})
+}
+
 func updateMetrics(dbFactory DBFactory) {
-	// Create a context that will be cancelled if it takes more than staleReadThreshold
-	ctx, cancel := context.WithTimeout(context.Background(), Config.staleReadThreshold)
-	defer cancel()
+	forEachDatabase(func(dbName string) {
+		var collectedAt time.Time
+		var tables []tableSnapshot
+		refresh(dbFactory, dbName, cacheMetrics, "tables", queryHistogram, func(db DB) (RowScanner, error) {
+			var rows RowScanner
+			var err error
 
-	start := time.Now()
+			switch Config.dbType {
+			case "cockroachdb":
+				rows, err = queryTables(db, dbName)
+			case "postgres":
+				rows, err = queryTablesPostgreSQL(db, dbName)
+			default:
+				panic(fmt.Sprintf("Assertion failed: Invalid database type: [%s]", Config.dbType))
+			}
+			if err != nil {
+				return nil, err
+			}
 
-	// Use a WaitGroup to know when the goroutine finishes its execution
-	var wg sync.WaitGroup
-	wg.Add(1)
+			collectedAt = time.Now()
 
-	// This channel will receive a signal from the goroutine when the query is done
-	doneChan := make(chan struct{})
+			// Forget partitions that have since been detached or dropped.
+			tablePartitionInfoGauge.DeletePartialMatch(prometheus.Labels{"db": dbName})
 
-	// This function will be executed in a goroutine
-	go func() {
-		defer wg.Done()
-		defer cancel()
+			// The tables are served by the API once they have all been read.
+			return &finishingRows{RowScanner: rows, finish: func(complete bool) {
+				if complete {
+					setTableSnapshots(dbName, tables)
+				}
+			}}, nil
+		}, func(rows RowScanner) error {
+			var schema, tableName, parentTable string
+			var size, estimatedRowCount, heapSize, toastSize, indexesSize float64
+			if err := rows.Scan(&schema, &tableName, &size, &estimatedRowCount, &heapSize, &toastSize, &indexesSize, &parentTable); err != nil {
+				return err
+			}
+			labels := []string{dbName, schema, tableName}
+			tableRowsGauge.WithLabelValues(labels...).Set(estimatedRowCount)
+			tableSizeGauge.WithLabelValues(labels...).Set(size)
+			tableHeapSizeGauge.WithLabelValues(labels...).Set(heapSize)
+			tableToastSizeGauge.WithLabelValues(labels...).Set(toastSize)
+			tableIndexesSizeGauge.WithLabelValues(labels...).Set(indexesSize)
+			if parentTable != "" {
+				tablePartitionInfoGauge.WithLabelValues(dbName, schema, tableName, parentTable).Set(1)
+			}
+			tables = append(tables, tableSnapshot{
+				Database:    dbName,
+				Schema:      schema,
+				Table:       tableName,
+				ParentTable: parentTable,
+				Rows:        estimatedRowCount,
+				Size:        size,
+				HeapSize:    heapSize,
+				ToastSize:   toastSize,
+				IndexesSize: indexesSize,
+				CollectedAt: collectedAt,
+			})
+			return nil
+		})
+	})
+}
+
+// updatePartitionedTablesMetrics exports the row count and size of every
+// PostgreSQL partitioned table, aggregated over its partitions. It is opt-in
+// since the partitions are already exported individually.
+func updatePartitionedTablesMetrics(dbFactory DBFactory) {
+	if !currentConfig().partitionRollup || Config.dbType != "postgres" {
+		return
+	}
 
-		db, err := dbFactory.New(Config.connStr)
+	forEachDatabase(func(dbName string) {
+		refresh(dbFactory, dbName, cacheMetrics, "partitioned_tables", queryHistogramPartitionedTables, func(db DB) (RowScanner, error) {
+			return queryPartitionedTablesPostgreSQL(db, dbName)
+		}, func(rows RowScanner) error {
+			var schema, tableName string
+			var partitions, rowCount, size float64
+			if err := rows.Scan(&schema, &tableName, &partitions, &rowCount, &size); err != nil {
+				return err
+			}
+			partitionedTablePartitionsGauge.WithLabelValues(dbName, schema, tableName).Set(partitions)
+			partitionedTableRowsGauge.WithLabelValues(dbName, schema, tableName).Set(rowCount)
+			partitionedTableSizeGauge.WithLabelValues(dbName, schema, tableName).Set(size)
+			return nil
+		})
+	})
+}
+
+// updateTableStatsMetrics exports the per-table maintenance and scan counters
+// that PostgreSQL keeps in pg_stat_user_tables. CockroachDB has no
+// equivalent, so nothing is queried there.
+func updateTableStatsMetrics(dbFactory DBFactory) {
+	if Config.dbType != "postgres" {
+		return
+	}
+
+	forEachDatabase(func(dbName string) {
+		refresh(dbFactory, dbName, cacheMetrics, "table_stats", queryHistogramTableStats, func(db DB) (RowScanner, error) {
+			return queryTableStatsPostgreSQL(db, dbName)
+		}, func(rows RowScanner) error {
+			var schema, tableName string
+			var live, dead float64
+			var lastVacuum, lastAutovacuum, lastAnalyze, lastAutoanalyze float64
+			var vacuums, autovacuums, analyzes, autoanalyzes float64
+			var seqScans, seqRowsRead, indexScans, indexRowsFetched float64
+			var xidAge, mxidAge, xidFreezeRemaining float64
+			if err := rows.Scan(&schema, &tableName, &live, &dead,
+				&lastVacuum, &lastAutovacuum, &lastAnalyze, &lastAutoanalyze,
+				&vacuums, &autovacuums, &analyzes, &autoanalyzes,
+				&seqScans, &seqRowsRead, &indexScans, &indexRowsFetched,
+				&xidAge, &mxidAge, &xidFreezeRemaining); err != nil {
+				return err
+			}
+
+			ratio := 0.0
+			if live+dead > 0 {
+				ratio = dead / (live + dead)
+			}
+
+			labels := []string{dbName, schema, tableName}
+			tableDeadRowsGauge.WithLabelValues(labels...).Set(dead)
+			tableDeadRowsRatioGauge.WithLabelValues(labels...).Set(ratio)
+			tableLastVacuumGauge.WithLabelValues(labels...).Set(lastVacuum)
+			tableLastAutovacuumGauge.WithLabelValues(labels...).Set(lastAutovacuum)
+			tableLastAnalyzeGauge.WithLabelValues(labels...).Set(lastAnalyze)
+			tableLastAutoanalyzeGauge.WithLabelValues(labels...).Set(lastAutoanalyze)
+			tableVacuumsCounter.WithLabelValues(labels...).Set(vacuums)
+			tableAutovacuumsCounter.WithLabelValues(labels...).Set(autovacuums)
+			tableAnalyzesCounter.WithLabelValues(labels...).Set(analyzes)
+			tableAutoanalyzesCounter.WithLabelValues(labels...).Set(autoanalyzes)
+			tableSeqScansCounter.WithLabelValues(labels...).Set(seqScans)
+			tableSeqRowsReadCounter.WithLabelValues(labels...).Set(seqRowsRead)
+			tableIndexScansCounter.WithLabelValues(labels...).Set(indexScans)
+			tableIndexRowsFetchedCounter.WithLabelValues(labels...).Set(indexRowsFetched)
+			tableXIDAgeGauge.WithLabelValues(labels...).Set(xidAge)
+			tableMXIDAgeGauge.WithLabelValues(labels...).Set(mxidAge)
+			tableXIDFreezeRemainingGauge.WithLabelValues(labels...).Set(xidFreezeRemaining)
+			return nil
+		})
+	})
+}
+
+// updateDatabaseStatsMetrics exports the database-wide activity counters and
+// size of every PostgreSQL database on the server.
+func updateDatabaseStatsMetrics(dbFactory DBFactory) {
+	if Config.dbType != "postgres" {
+		return
+	}
+
+	refresh(dbFactory, serverDatabase(), cacheMetrics, "database_stats", queryHistogramDatabaseStats, func(db DB) (RowScanner, error) {
+		return queryDatabaseStatsPostgreSQL(db, serverDatabase())
+	}, func(rows RowScanner) error {
+		var dbName string
+		var commits, rollbacks, deadlocks, conflicts, tempFiles, tempBytes, blocksRead, blocksHit, size float64
+		if err := rows.Scan(&dbName, &commits, &rollbacks, &deadlocks, &conflicts,
+			&tempFiles, &tempBytes, &blocksRead, &blocksHit, &size); err != nil {
+			return err
+		}
+		databaseCommitsCounter.WithLabelValues(dbName).Set(commits)
+		databaseRollbacksCounter.WithLabelValues(dbName).Set(rollbacks)
+		databaseDeadlocksCounter.WithLabelValues(dbName).Set(deadlocks)
+		databaseConflictsCounter.WithLabelValues(dbName).Set(conflicts)
+		databaseTempFilesCounter.WithLabelValues(dbName).Set(tempFiles)
+		databaseTempBytesCounter.WithLabelValues(dbName).Set(tempBytes)
+		databaseBlocksReadCounter.WithLabelValues(dbName).Set(blocksRead)
+		databaseBlocksHitCounter.WithLabelValues(dbName).Set(blocksHit)
+		databaseSizeGauge.WithLabelValues(dbName).Set(size)
+		return nil
+	})
+}
+
+// updateDatabaseWraparoundMetrics exports the transaction ID wraparound
+// horizon of every PostgreSQL database on the server.
+func updateDatabaseWraparoundMetrics(dbFactory DBFactory) {
+	if Config.dbType != "postgres" {
+		return
+	}
+
+	refresh(dbFactory, serverDatabase(), cacheMetrics, "database_wraparound", queryHistogramDatabaseWraparound, func(db DB) (RowScanner, error) {
+		return queryDatabaseWraparoundPostgreSQL(db, serverDatabase())
+	}, func(rows RowScanner) error {
+		var dbName string
+		var xidAge, mxidAge, xidFreezeRemaining float64
+		if err := rows.Scan(&dbName, &xidAge, &mxidAge, &xidFreezeRemaining); err != nil {
+			return err
+		}
+		databaseXIDAgeGauge.WithLabelValues(dbName).Set(xidAge)
+		databaseMXIDAgeGauge.WithLabelValues(dbName).Set(mxidAge)
+		databaseXIDFreezeRemainingGauge.WithLabelValues(dbName).Set(xidFreezeRemaining)
+		return nil
+	})
+}
+
+// updateStatementsMetrics exports the most expensive statements from
+// pg_stat_statements. Whether the extension is installed is exported as a
+// metric rather than reported as a query error on every refresh.
+func updateStatementsMetrics(dbFactory DBFactory) {
+	cfg := currentConfig()
+	if cfg.dbType != "postgres" || cfg.statementsLimit <= 0 {
+		return
+	}
+
+	current := map[string][]string{}
+	refresh(dbFactory, serverDatabase(), cacheMetrics, "statements", queryHistogramStatements, func(db DB) (RowScanner, error) {
+		installed, err := hasExtensionPostgreSQL(db, "pg_stat_statements")
 		if err != nil {
-			log.Println("Failed to open connection:", err)
-			queryErrorsCounter.Inc()
-			return
+			return nil, err
 		}
-		defer db.Close()
+		if !installed {
+			statementsInstalledGauge.WithLabelValues(serverDatabase()).Set(0)
+			return nil, nil
+		}
+		statementsInstalledGauge.WithLabelValues(serverDatabase()).Set(1)
+
+		rows, err := queryStatementsPostgreSQL(db, serverDatabase(), cfg.statementsLimit)
+		if err != nil {
+			return nil, err
+		}
+
+		// The top-N set changes between refreshes. Statements that fell out
+		// of it are deleted once the new set has been read, so that a
+		// concurrent scrape never sees an empty or partial set.
+		return &finishingRows{RowScanner: rows, finish: func(complete bool) {
+			if complete {
+				deleteStaleStatements(current)
+			}
+		}}, nil
+	}, func(rows RowScanner) error {
+		var queryID, user, dbName string
+		var calls, totalTime, meanTime, rowCount float64
+		var sharedBlksHit, sharedBlksRead, tempBlksRead, tempBlksWritten float64
+		if err := rows.Scan(&queryID, &user, &dbName, &calls, &totalTime, &meanTime, &rowCount,
+			&sharedBlksHit, &sharedBlksRead, &tempBlksRead, &tempBlksWritten); err != nil {
+			return err
+		}
+
+		labels := []string{dbName, user, queryID}
+		statementCallsCounter.WithLabelValues(labels...).Set(calls)
+		statementTimeCounter.WithLabelValues(labels...).Set(totalTime)
+		statementMeanTimeGauge.WithLabelValues(labels...).Set(meanTime)
+		statementRowsCounter.WithLabelValues(labels...).Set(rowCount)
+		statementSharedBlksHitCounter.WithLabelValues(labels...).Set(sharedBlksHit)
+		statementSharedBlksReadCounter.WithLabelValues(labels...).Set(sharedBlksRead)
+		statementTempBlksReadCounter.WithLabelValues(labels...).Set(tempBlksRead)
+		statementTempBlksWrittenCounter.WithLabelValues(labels...).Set(tempBlksWritten)
+		current[strings.Join(labels, "\x00")] = labels
+		return nil
+	})
+}
+
+// statementLabels holds the label values of the statements exported by the
+// last complete refresh, keyed by their joined values.
+var (
+	statementLabelsMu sync.Mutex
+	statementLabels   = map[string][]string{}
+)
+
+// deleteStaleStatements deletes the series of the statements that are not in
+// current, and remembers current for the next refresh.
+func deleteStaleStatements(current map[string][]string) {
+	statementLabelsMu.Lock()
+	defer statementLabelsMu.Unlock()
 
-		var rows RowScanner
+	for key, labels := range statementLabels {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		for _, metric := range statementsMetrics {
+			metric.DeleteLabelValues(labels...)
+		}
+	}
+	statementLabels = current
+}
+
+// finishingRows calls finish once the rows are closed, telling whether they
+// were all read without error.
+type finishingRows struct {
+	RowScanner
+	finish func(complete bool)
+}
+
+func (r *finishingRows) Close() error {
+	complete := r.Err() == nil
+	err := r.RowScanner.Close()
+	r.finish(complete)
+	return err
+}
+
+// updateReplicationMetrics exports the lag of every standby connected to the
+// PostgreSQL server, as seen from the primary.
+func updateReplicationMetrics(dbFactory DBFactory) {
+	if Config.dbType != "postgres" {
+		return
+	}
 
-		switch Config.dbType {
-		case "cockroachdb":
-			rows, err = queryTables(db, Config.dbName)
-		case "postgres":
-			rows, err = queryTablesPostgreSQL(db, Config.dbName)
-		default:
-			panic(fmt.Sprintf("Assertion failed: Invalid database type: [%s]", Config.dbType))
+	refresh(dbFactory, serverDatabase(), cacheMetrics, "replication", queryHistogramReplication, func(db DB) (RowScanner, error) {
+		rows, err := queryReplicationPostgreSQL(db, serverDatabase())
+		if err != nil {
+			return nil, err
+		}
+
+		// Forget standbys that have disconnected.
+		replicationLagBytesGauge.Reset()
+		replicationLagSecondsGauge.Reset()
+		return rows, nil
+	}, func(rows RowScanner) error {
+		var applicationName, clientAddr string
+		var writeBytes, flushBytes, replayBytes, writeSeconds, flushSeconds, replaySeconds float64
+		if err := rows.Scan(&applicationName, &clientAddr, &writeBytes, &flushBytes, &replayBytes,
+			&writeSeconds, &flushSeconds, &replaySeconds); err != nil {
+			return err
 		}
+		replicationLagBytesGauge.WithLabelValues(applicationName, clientAddr, "write").Set(writeBytes)
+		replicationLagBytesGauge.WithLabelValues(applicationName, clientAddr, "flush").Set(flushBytes)
+		replicationLagBytesGauge.WithLabelValues(applicationName, clientAddr, "replay").Set(replayBytes)
+		replicationLagSecondsGauge.WithLabelValues(applicationName, clientAddr, "write").Set(writeSeconds)
+		replicationLagSecondsGauge.WithLabelValues(applicationName, clientAddr, "flush").Set(flushSeconds)
+		replicationLagSecondsGauge.WithLabelValues(applicationName, clientAddr, "replay").Set(replaySeconds)
+		return nil
+	})
+}
 
+// updateReplicationSlotsMetrics exports the state of every PostgreSQL
+// replication slot. Inactive slots keep retaining WAL until they are dropped.
+func updateReplicationSlotsMetrics(dbFactory DBFactory) {
+	if Config.dbType != "postgres" {
+		return
+	}
+
+	refresh(dbFactory, serverDatabase(), cacheMetrics, "replication_slots", queryHistogramReplicationSlots, func(db DB) (RowScanner, error) {
+		rows, err := queryReplicationSlotsPostgreSQL(db, serverDatabase())
 		if err != nil {
-			log.Println("Failed to execute query:", err)
-			queryErrorsCounter.Inc()
-			return
+			return nil, err
 		}
-		defer rows.Close()
 
-		for rows.Next() {
+		// Forget slots that have been dropped.
+		replicationSlotActiveGauge.Reset()
+		replicationSlotRetainedBytesGauge.Reset()
+		replicationSlotWALStatusGauge.Reset()
+		return rows, nil
+	}, func(rows RowScanner) error {
+		var slotName, slotType, dbName, walStatus string
+		var active bool
+		var retainedBytes float64
+		if err := rows.Scan(&slotName, &slotType, &dbName, &active, &retainedBytes, &walStatus); err != nil {
+			return err
+		}
+
+		activeValue := 0.0
+		if active {
+			activeValue = 1
+		}
+		replicationSlotActiveGauge.WithLabelValues(dbName, slotName, slotType).Set(activeValue)
+		replicationSlotRetainedBytesGauge.WithLabelValues(dbName, slotName, slotType).Set(retainedBytes)
+		if walStatus != "" {
+			replicationSlotWALStatusGauge.WithLabelValues(dbName, slotName, slotType, walStatus).Set(1)
+		}
+		return nil
+	})
+}
+
+// updateRecoveryMetrics exports whether the PostgreSQL server is a standby,
+// and its replay lag if it is.
+func updateRecoveryMetrics(dbFactory DBFactory) {
+	if Config.dbType != "postgres" {
+		return
+	}
+
+	refresh(dbFactory, serverDatabase(), cacheMetrics, "recovery", queryHistogramRecovery, func(db DB) (RowScanner, error) {
+		return queryRecoveryPostgreSQL(db, serverDatabase())
+	}, func(rows RowScanner) error {
+		var inRecovery bool
+		var replayLag float64
+		if err := rows.Scan(&inRecovery, &replayLag); err != nil {
+			return err
+		}
+
+		inRecoveryValue := 0.0
+		if inRecovery {
+			inRecoveryValue = 1
+		}
+		recoveryGauge.Set(inRecoveryValue)
+		recoveryReplayLagGauge.Set(replayLag)
+		return nil
+	})
+}
+
+// updateLocksMetrics exports lock contention per table: how many lock
+// requests are waiting, for how long, and behind how many blockers.
+func updateLocksMetrics(dbFactory DBFactory) {
+	forEachDatabase(func(dbName string) {
+		refresh(dbFactory, dbName, cacheMetrics, "locks", queryHistogramLocks, func(db DB) (RowScanner, error) {
+			var rows RowScanner
+			var err error
+
+			switch Config.dbType {
+			case "cockroachdb":
+				rows, err = queryLocks(db, dbName)
+			case "postgres":
+				rows, err = queryLocksPostgreSQL(db, dbName)
+			default:
+				panic(fmt.Sprintf("Assertion failed: Invalid database type: [%s]", Config.dbType))
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			// Only tables with waiting locks are returned, so clear tables whose
+			// locks have since been granted.
+			lockWaitingGauge.DeletePartialMatch(prometheus.Labels{"db": dbName})
+			lockMaxWaitGauge.DeletePartialMatch(prometheus.Labels{"db": dbName})
+			lockMaxChainDepthGauge.DeletePartialMatch(prometheus.Labels{"db": dbName})
+			return rows, nil
+		}, func(rows RowScanner) error {
 			var schema, tableName string
-			var size, estimatedRowCount float64
-			if err := rows.Scan(&schema, &tableName, &size, &estimatedRowCount); err != nil {
-				log.Println("Failed to scan row:", err)
-				queryErrorsCounter.Inc()
-			} else {
-				tableRowsGauge.WithLabelValues(Config.dbName, schema, tableName).Set(estimatedRowCount)
-				tableSizeGauge.WithLabelValues(Config.dbName, schema, tableName).Set(size)
+			var waiting, maxWait, maxChainDepth float64
+			if err := rows.Scan(&schema, &tableName, &waiting, &maxWait, &maxChainDepth); err != nil {
+				return err
+			}
+			lockWaitingGauge.WithLabelValues(dbName, schema, tableName).Set(waiting)
+			lockMaxWaitGauge.WithLabelValues(dbName, schema, tableName).Set(maxWait)
+			lockMaxChainDepthGauge.WithLabelValues(dbName, schema, tableName).Set(maxChainDepth)
+			return nil
+		})
+	})
+}
+
+// updateTableIOMetrics exports how many blocks of every PostgreSQL table were
+// read from disk versus found in shared buffers.
+func updateTableIOMetrics(dbFactory DBFactory) {
+	if Config.dbType != "postgres" {
+		return
+	}
+
+	forEachDatabase(func(dbName string) {
+		refresh(dbFactory, dbName, cacheMetrics, "table_io", queryHistogramTableIO, func(db DB) (RowScanner, error) {
+			return queryTableIOPostgreSQL(db, dbName)
+		}, func(rows RowScanner) error {
+			var schema, tableName string
+			var heapRead, heapHit, indexRead, indexHit, toastRead, toastHit, toastIndexRead, toastIndexHit float64
+			if err := rows.Scan(&schema, &tableName, &heapRead, &heapHit, &indexRead, &indexHit,
+				&toastRead, &toastHit, &toastIndexRead, &toastIndexHit); err != nil {
+				return err
+			}
+			tableBlocksReadCounter.WithLabelValues(dbName, schema, tableName, "heap").Set(heapRead)
+			tableBlocksHitCounter.WithLabelValues(dbName, schema, tableName, "heap").Set(heapHit)
+			tableBlocksReadCounter.WithLabelValues(dbName, schema, tableName, "index").Set(indexRead)
+			tableBlocksHitCounter.WithLabelValues(dbName, schema, tableName, "index").Set(indexHit)
+			tableBlocksReadCounter.WithLabelValues(dbName, schema, tableName, "toast").Set(toastRead)
+			tableBlocksHitCounter.WithLabelValues(dbName, schema, tableName, "toast").Set(toastHit)
+			tableBlocksReadCounter.WithLabelValues(dbName, schema, tableName, "toast_index").Set(toastIndexRead)
+			tableBlocksHitCounter.WithLabelValues(dbName, schema, tableName, "toast_index").Set(toastIndexHit)
+			return nil
+		})
+	})
+}
+
+// updateIndexIOMetrics exports how many blocks of every PostgreSQL index were
+// read from disk versus found in shared buffers.
+func updateIndexIOMetrics(dbFactory DBFactory) {
+	if Config.dbType != "postgres" {
+		return
+	}
+
+	forEachDatabase(func(dbName string) {
+		refresh(dbFactory, dbName, cacheIndices, "index_io", queryHistogramIndexIO, func(db DB) (RowScanner, error) {
+			return queryIndexIOPostgreSQL(db, dbName)
+		}, func(rows RowScanner) error {
+			var schema, table, indexName, indexType, indexUnique string
+			var blocksRead, blocksHit float64
+			if err := rows.Scan(&schema, &table, &indexName, &indexType, &indexUnique, &blocksRead, &blocksHit); err != nil {
+				return err
+			}
+			indexBlocksReadCounter.WithLabelValues(dbName, schema, table, indexName, indexType, indexUnique).Set(blocksRead)
+			indexBlocksHitCounter.WithLabelValues(dbName, schema, table, indexName, indexType, indexUnique).Set(blocksHit)
+			return nil
+		})
+	})
+}
+
+// updateIndexProblemsMetrics flags invalid, duplicate and redundant indexes.
+func updateIndexProblemsMetrics(dbFactory DBFactory) {
+	forEachDatabase(func(dbName string) {
+		refresh(dbFactory, dbName, cacheIndices, "index_problems", queryHistogramIndexProblems, func(db DB) (RowScanner, error) {
+			var rows RowScanner
+			var err error
+
+			switch Config.dbType {
+			case "cockroachdb":
+				rows, err = queryIndexProblems(db, dbName)
+			case "postgres":
+				rows, err = queryIndexProblemsPostgreSQL(db, dbName)
+			default:
+				panic(fmt.Sprintf("Assertion failed: Invalid database type: [%s]", Config.dbType))
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			// Clear indexes that have since been fixed or dropped.
+			indexProblemGauge.DeletePartialMatch(prometheus.Labels{"db": dbName})
+			indexProblemSizeGauge.DeletePartialMatch(prometheus.Labels{"db": dbName})
+			return rows, nil
+		}, func(rows RowScanner) error {
+			var schema, table, indexName, indexType, indexUnique, problem, related string
+			var size sql.NullFloat64
+			if err := rows.Scan(&schema, &table, &indexName, &indexType, &indexUnique, &problem, &related, &size); err != nil {
+				return err
+			}
+			indexProblemGauge.WithLabelValues(dbName, schema, table, indexName, indexType, indexUnique, problem, related).Set(1)
+			if size.Valid {
+				indexProblemSizeGauge.WithLabelValues(dbName, schema, table, indexName, indexType, indexUnique).Set(size.Float64)
+			}
+			return nil
+		})
+	})
+}
+
+// updateSequencesMetrics exports how close every sequence, and every column
+// fed by a sequence, is to running out of values.
+func updateSequencesMetrics(dbFactory DBFactory) {
+	forEachDatabase(func(dbName string) {
+		refresh(dbFactory, dbName, cacheMetrics, "sequences", queryHistogramSequences, func(db DB) (RowScanner, error) {
+			switch Config.dbType {
+			case "cockroachdb":
+				return querySequences(db, dbName)
+			case "postgres":
+				return querySequencesPostgreSQL(db, dbName)
+			default:
+				panic(fmt.Sprintf("Assertion failed: Invalid database type: [%s]", Config.dbType))
+			}
+		}, func(rows RowScanner) error {
+			var schema, sequence, tableSchema, tableName, column string
+			var current, maxValue, usedRatio, columnUsedRatio float64
+			if err := rows.Scan(&schema, &sequence, &current, &maxValue, &usedRatio,
+				&tableSchema, &tableName, &column, &columnUsedRatio); err != nil {
+				return err
+			}
+			sequenceCurrentValueGauge.WithLabelValues(dbName, schema, sequence).Set(current)
+			sequenceMaxValueGauge.WithLabelValues(dbName, schema, sequence).Set(maxValue)
+			sequenceUsedRatioGauge.WithLabelValues(dbName, schema, sequence).Set(usedRatio)
+			if column != "" {
+				sequenceColumnUsedRatioGauge.WithLabelValues(dbName, tableSchema, tableName, column, sequence).Set(columnUsedRatio)
 			}
+			return nil
+		})
+	})
+}
+
+// updateServerStatsMetrics exports the checkpointer, background writer and
+// WAL activity of the PostgreSQL server.
+func updateServerStatsMetrics(dbFactory DBFactory) {
+	if Config.dbType != "postgres" {
+		return
+	}
+
+	refresh(dbFactory, serverDatabase(), cacheMetrics, "server_stats", queryHistogramServerStats, func(db DB) (RowScanner, error) {
+		return queryServerStatsPostgreSQL(db, serverDatabase())
+	}, func(rows RowScanner) error {
+		var name string
+		var value float64
+		if err := rows.Scan(&name, &value); err != nil {
+			return err
+		}
+		if gauge, ok := serverStatsMetrics[name]; ok {
+			gauge.Set(value)
 		}
+		return nil
+	})
+}
 
-		if err := rows.Err(); err != nil {
-			log.Println("Error fetching rows:", err)
-			queryErrorsCounter.Inc()
+// updateActivityMetrics exports the client connections to the PostgreSQL
+// server and how long the oldest transactions have been open.
+func updateActivityMetrics(dbFactory DBFactory) {
+	if Config.dbType != "postgres" {
+		return
+	}
+
+	refresh(dbFactory, serverDatabase(), cacheMetrics, "activity", queryHistogramActivity, func(db DB) (RowScanner, error) {
+		rows, err := queryActivityPostgreSQL(db, serverDatabase())
+		if err != nil {
+			return nil, err
 		}
 
-		queryHistogram.Observe(time.Since(start).Seconds())
-		cacheMetrics.Set("metrics", true, cache.DefaultExpiration)
-		doneChan <- struct{}{}
-	}()
+		// Forget connection states and databases no longer present.
+		connectionsGauge.Reset()
+		idleInTransactionMaxAgeGauge.Reset()
+		oldestTransactionAgeGauge.Reset()
+		return rows, nil
+	}, func(rows RowScanner) error {
+		var dbName, user, applicationName, state, waitEventType string
+		var connections, idleInTransactionMaxAge, oldestTransactionAge, maxConnections, reservedConnections float64
+		if err := rows.Scan(&dbName, &user, &applicationName, &state, &waitEventType, &connections,
+			&idleInTransactionMaxAge, &oldestTransactionAge, &maxConnections, &reservedConnections); err != nil {
+			return err
+		}
+		connectionsGauge.WithLabelValues(dbName, user, applicationName, state, waitEventType).Set(connections)
+		idleInTransactionMaxAgeGauge.WithLabelValues(dbName).Set(idleInTransactionMaxAge)
+		oldestTransactionAgeGauge.WithLabelValues(dbName).Set(oldestTransactionAge)
+		maxConnectionsGauge.Set(maxConnections)
+		reservedConnectionsGauge.Set(reservedConnections)
+		return nil
+	})
+}
 
-	// Wait for the signal from the goroutine or the context timeout
-	select {
-	case <-ctx.Done():
-		// If the context is done (it took more than 3 seconds),
-		// update the cache timeout and return a stale read
-		cacheMetrics.Set("metrics", true, cache.DefaultExpiration)
-		queryStaleReadsCounter.Inc()
+// exactRowsSelected reports whether schema.table matches one of the
+// comma-separated patterns in cfg.exactRowsTables.
+func exactRowsSelected(cfg config, schema, table string) bool {
+	for _, pattern := range strings.Split(cfg.exactRowsTables, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if matched, _ := path.Match(pattern, schema+"."+table); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// countRows counts the rows of a single table in a transaction of its own,
+// giving up after cfg.exactRowsTimeout. The timeout is enforced by the
+// server, so that the count is cancelled there too.
+func countRows(cfg config, db DB, dbName, schema, table string) (float64, error) {
+	// Leave the server time to report its own timeout first.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.exactRowsTimeout+time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", cfg.exactRowsTimeout.Milliseconds())); err != nil {
+		return 0, err
+	}
+
+	var rows RowScanner
+
+	switch cfg.dbType {
+	case "cockroachdb":
+		rows, err = queryExactRowCount(ctx, tx, dbName, schema, table)
+	case "postgres":
+		rows, err = queryExactRowCountPostgreSQL(ctx, tx, dbName, schema, table, cfg.exactRowsSample)
+	default:
+		panic(fmt.Sprintf("Assertion failed: Invalid database type: [%s]", cfg.dbType))
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count float64
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+	return count, rows.Err()
+}
+
+// updateExactRowsMetrics counts the rows of the tables selected with
+// -exact_rows_tables whose estimated row count is at most
+// -exact_rows_max_estimate. The counts are exported separately from the
+// estimates in table_rows.
+func updateExactRowsMetrics(dbFactory DBFactory) {
+	cfg := currentConfig()
+	if cfg.exactRowsTables == "" {
 		return
-	case <-doneChan:
-		// If a signal arrives from the channel, the query is done and the metrics are updated
 	}
 
-	// Wait for the goroutine to finish
-	wg.Wait()
+	forEachDatabase(func(dbName string) {
+		var conn DB
+		refresh(dbFactory, dbName, cacheExactRows, "exact_rows", queryHistogramExactRows, func(db DB) (RowScanner, error) {
+			conn = db
+			var rows RowScanner
+			var err error
+
+			switch cfg.dbType {
+			case "cockroachdb":
+				rows, err = queryTables(db, dbName)
+			case "postgres":
+				rows, err = queryTablesPostgreSQL(db, dbName)
+			default:
+				panic(fmt.Sprintf("Assertion failed: Invalid database type: [%s]", cfg.dbType))
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			// Select the tables up front and close the table list, so that
+			// counting does not hold a second connection.
+			selected, err := selectExactRowsTables(cfg, rows)
+			if err != nil {
+				return nil, err
+			}
+
+			// Forget tables that were dropped or are no longer selected.
+			tableRowsExactGauge.DeletePartialMatch(prometheus.Labels{"db": dbName})
+			return selected, nil
+		}, func(rows RowScanner) error {
+			var schema, tableName string
+			if err := rows.Scan(&schema, &tableName); err != nil {
+				return err
+			}
+
+			count, err := countRows(cfg, conn, dbName, schema, tableName)
+			if err != nil {
+				log.Printf("Failed to count rows of %s.%s: %v", schema, tableName, err)
+				queryErrorsCounter.Inc()
+				recordRefreshError("exact_rows", dbName, fmt.Errorf("counting rows of %s.%s: %w", schema, tableName, err), false)
+				return nil
+			}
+			tableRowsExactGauge.WithLabelValues(dbName, schema, tableName).Set(count)
+			return nil
+		})
+	})
 }
 
-func metricsHandler(w http.ResponseWriter, r *http.Request) {
-	if _, found := cacheMetrics.Get("metrics"); !found {
-		updateMetrics(&SqlDBFactory{})
+// selectExactRowsTables reads the tables selected for exact counting from the
+// table list rows and closes them.
+func selectExactRowsTables(cfg config, rows RowScanner) (RowScanner, error) {
+	defer rows.Close()
+
+	selected := &tableNames{}
+	for rows.Next() {
+		var schema, tableName, parentTable string
+		var size, estimatedRowCount, heapSize, toastSize, indexesSize float64
+		if err := rows.Scan(&schema, &tableName, &size, &estimatedRowCount, &heapSize, &toastSize, &indexesSize, &parentTable); err != nil {
+			return nil, err
+		}
+		if exactRowsSelected(cfg, schema, tableName) && estimatedRowCount <= cfg.exactRowsMax {
+			selected.names = append(selected.names, [2]string{schema, tableName})
+		}
 	}
+	return selected, rows.Err()
+}
+
+// tableNames is a RowScanner over schema and table name pairs read ahead of
+// time.
+type tableNames struct {
+	names   [][2]string
+	current int
+}
+
+func (t *tableNames) Next() bool {
+	t.current++
+	return t.current <= len(t.names)
+}
 
-	if _, found := cacheIndices.Get("metricsIndices"); !found {
-		updateIndicesMetrics(&SqlDBFactory{})
+func (t *tableNames) Scan(dest ...interface{}) error {
+	if len(dest) != 2 {
+		return fmt.Errorf("expected 2 destination arguments in Scan, not %d", len(dest))
+	}
+	name := t.names[t.current-1]
+	*dest[0].(*string) = name[0]
+	*dest[1].(*string) = name[1]
+	return nil
+}
+
+func (t *tableNames) Err() error {
+	return nil
+}
+
+func (t *tableNames) Close() error {
+	return nil
+}
+
+// updateIOMetrics exports the server's I/O broken down by backend type,
+// object and context from pg_stat_io, on PostgreSQL 16 and later.
+func updateIOMetrics(dbFactory DBFactory) {
+	if Config.dbType != "postgres" {
+		return
+	}
+
+	refresh(dbFactory, serverDatabase(), cacheMetrics, "io", queryHistogramIO, func(db DB) (RowScanner, error) {
+		return queryIOPostgreSQL(db, serverDatabase())
+	}, func(rows RowScanner) error {
+		var backendType, object, ioContext, operation string
+		var count, seconds float64
+		var timed bool
+		if err := rows.Scan(&backendType, &object, &ioContext, &operation, &count, &seconds, &timed); err != nil {
+			return err
+		}
+		ioOperationsCounter.WithLabelValues(backendType, object, ioContext, operation).Set(count)
+		if timed {
+			ioTimeCounter.WithLabelValues(backendType, object, ioContext, operation).Set(seconds)
+		}
+		return nil
+	})
+}
+
+// updateTableBloatMetrics exports the estimated bloat of every PostgreSQL
+// table. It is opt-in since the estimation is expensive on large schemas.
+func updateTableBloatMetrics(dbFactory DBFactory) {
+	if !currentConfig().collectBloat || Config.dbType != "postgres" {
+		return
 	}
 
-	promhttp.Handler().ServeHTTP(w, r)
-	checkRequests()
+	forEachDatabase(func(dbName string) {
+		refresh(dbFactory, dbName, cacheBloat, "table_bloat", queryHistogramTableBloat, func(db DB) (RowScanner, error) {
+			return queryTableBloatPostgreSQL(db, dbName)
+		}, func(rows RowScanner) error {
+			var schema, tableName string
+			var realSize, bloatSize, bloatRatio float64
+			if err := rows.Scan(&schema, &tableName, &realSize, &bloatSize, &bloatRatio); err != nil {
+				return err
+			}
+			tableBloatGauge.WithLabelValues(dbName, schema, tableName).Set(bloatSize)
+			tableBloatRatioGauge.WithLabelValues(dbName, schema, tableName).Set(bloatRatio)
+			return nil
+		})
+	})
+}
+
+// updateIndexBloatMetrics exports the estimated bloat of every PostgreSQL
+// B-tree index.
+func updateIndexBloatMetrics(dbFactory DBFactory) {
+	if !currentConfig().collectBloat || Config.dbType != "postgres" {
+		return
+	}
+
+	forEachDatabase(func(dbName string) {
+		refresh(dbFactory, dbName, cacheBloat, "index_bloat", queryHistogramIndexBloat, func(db DB) (RowScanner, error) {
+			return queryIndexBloatPostgreSQL(db, dbName)
+		}, func(rows RowScanner) error {
+			var schema, table, indexName, indexType, indexUnique string
+			var realSize, bloatSize, bloatRatio float64
+			if err := rows.Scan(&schema, &table, &indexName, &indexType, &indexUnique, &realSize, &bloatSize, &bloatRatio); err != nil {
+				return err
+			}
+			indexBloatGauge.WithLabelValues(dbName, schema, table, indexName, indexType, indexUnique).Set(bloatSize)
+			indexBloatRatioGauge.WithLabelValues(dbName, schema, table, indexName, indexType, indexUnique).Set(bloatRatio)
+			return nil
+		})
+	})
+}
+
+// listenAndServe serves server on its address with the TLS and basic
+// authentication settings of -web_config_file. The web configuration file is
+// read again for every new connection, so renewed certificates and changed
+// users take effect without a restart.
+func listenAndServe(server *http.Server) error {
+	listenAddresses := []string{server.Addr}
+	systemdSocket := false
+	webFlags := &web.FlagConfig{
+		WebListenAddresses: &listenAddresses,
+		WebSystemdSocket:   &systemdSocket,
+		WebConfigFile:      &Config.webConfigFile,
+	}
+
+	logger := kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(log.Writer()))
+	return web.ListenAndServe(server, webFlags, logger)
 }
 
 func main() {
 	flag.StringVar(&Config.connStr, "connstr", os.Getenv("CONNSTR"), "Database connection string (environment variable: CONNSTR)")
-	flag.StringVar(&Config.dbName, "db", os.Getenv("DB"), "Database name (environment variable: DB)")
+	flag.StringVar(&Config.dbName, "db", os.Getenv("DB"), "Comma-separated database names (environment variable: DB)")
 	flag.IntVar(&Config.requestLimit, "request_limit", 0, "The maximum number of requests the server will accept before shutting down")
 	flag.StringVar(&Config.listenAddress, "listen_address", os.Getenv("LISTEN_ADDRESS"), "Address to listen on (environment variable: LISTEN_ADDRESS)")
 	flag.StringVar(&Config.dbType, "dbtype", "cockroachdb", "Database type: cockroachdb or postgres (default: cockroachdb)")
@@ -272,6 +1241,82 @@ func main() {
 	}
 	flag.DurationVar(&Config.cacheTTLIndices, "cache_ttl_indices", Config.cacheTTLIndices, "Cache TTL Indices (environment variable: CACHE_TTL_INDICES)")
 
+	Config.collectBloat = os.Getenv("COLLECT_BLOAT") == "true"
+	flag.BoolVar(&Config.collectBloat, "collect_bloat", Config.collectBloat, "Estimate table and index bloat on PostgreSQL (environment variable: COLLECT_BLOAT)")
+
+	cacheTTLBloatStr := os.Getenv("CACHE_TTL_BLOAT")
+	if cacheTTLBloatStr != "" {
+		var err error
+		Config.cacheTTLBloat, err = time.ParseDuration(cacheTTLBloatStr)
+		if err != nil {
+			log.Fatal("Invalid CACHE_TTL_BLOAT, must be a valid Go duration string: ", err)
+		}
+	} else {
+		Config.cacheTTLBloat = time.Duration(1) * time.Hour
+	}
+	flag.DurationVar(&Config.cacheTTLBloat, "cache_ttl_bloat", Config.cacheTTLBloat, "Cache TTL Bloat (environment variable: CACHE_TTL_BLOAT)")
+
+	flag.StringVar(&Config.collectors, "collectors", os.Getenv("COLLECTORS"), "Comma-separated collectors to enable, all if empty (environment variable: COLLECTORS)")
+	flag.StringVar(&Config.collectorsDisabled, "collectors_disabled", os.Getenv("COLLECTORS_DISABLED"), "Comma-separated collectors to disable (environment variable: COLLECTORS_DISABLED)")
+
+	flag.StringVar(&Config.exactRowsTables, "exact_rows_tables", os.Getenv("EXACT_ROWS_TABLES"), "Comma-separated schema.table patterns to count rows of exactly (environment variable: EXACT_ROWS_TABLES)")
+
+	Config.exactRowsMax = 100000
+	if exactRowsMaxStr := os.Getenv("EXACT_ROWS_MAX_ESTIMATE"); exactRowsMaxStr != "" {
+		var err error
+		Config.exactRowsMax, err = strconv.ParseFloat(exactRowsMaxStr, 64)
+		if err != nil {
+			log.Fatal("Invalid EXACT_ROWS_MAX_ESTIMATE, must be a number: ", err)
+		}
+	}
+	flag.Float64Var(&Config.exactRowsMax, "exact_rows_max_estimate", Config.exactRowsMax, "Only count rows of tables with at most this many estimated rows (environment variable: EXACT_ROWS_MAX_ESTIMATE)")
+
+	if exactRowsSampleStr := os.Getenv("EXACT_ROWS_SAMPLE_PERCENT"); exactRowsSampleStr != "" {
+		var err error
+		Config.exactRowsSample, err = strconv.ParseFloat(exactRowsSampleStr, 64)
+		if err != nil {
+			log.Fatal("Invalid EXACT_ROWS_SAMPLE_PERCENT, must be a number: ", err)
+		}
+	}
+	flag.Float64Var(&Config.exactRowsSample, "exact_rows_sample_percent", Config.exactRowsSample, "Estimate row counts from a TABLESAMPLE of this percentage instead of counting, PostgreSQL only (environment variable: EXACT_ROWS_SAMPLE_PERCENT)")
+
+	exactRowsTimeoutStr := os.Getenv("EXACT_ROWS_TIMEOUT")
+	if exactRowsTimeoutStr != "" {
+		var err error
+		Config.exactRowsTimeout, err = time.ParseDuration(exactRowsTimeoutStr)
+		if err != nil {
+			log.Fatal("Invalid EXACT_ROWS_TIMEOUT, must be a valid Go duration string: ", err)
+		}
+	} else {
+		Config.exactRowsTimeout = time.Duration(10) * time.Second
+	}
+	flag.DurationVar(&Config.exactRowsTimeout, "exact_rows_timeout", Config.exactRowsTimeout, "Statement timeout for counting the rows of a table (environment variable: EXACT_ROWS_TIMEOUT)")
+
+	cacheTTLExactRowsStr := os.Getenv("CACHE_TTL_EXACT_ROWS")
+	if cacheTTLExactRowsStr != "" {
+		var err error
+		Config.cacheTTLExactRows, err = time.ParseDuration(cacheTTLExactRowsStr)
+		if err != nil {
+			log.Fatal("Invalid CACHE_TTL_EXACT_ROWS, must be a valid Go duration string: ", err)
+		}
+	} else {
+		Config.cacheTTLExactRows = time.Duration(15) * time.Minute
+	}
+	flag.DurationVar(&Config.cacheTTLExactRows, "cache_ttl_exact_rows", Config.cacheTTLExactRows, "Cache TTL Exact Rows (environment variable: CACHE_TTL_EXACT_ROWS)")
+
+	Config.partitionRollup = os.Getenv("PARTITION_ROLLUP") == "true"
+	flag.BoolVar(&Config.partitionRollup, "partition_rollup", Config.partitionRollup, "Export aggregated rows and size of PostgreSQL partitioned tables (environment variable: PARTITION_ROLLUP)")
+
+	Config.statementsLimit = 20
+	if statementsLimitStr := os.Getenv("STATEMENTS_LIMIT"); statementsLimitStr != "" {
+		var err error
+		Config.statementsLimit, err = strconv.Atoi(statementsLimitStr)
+		if err != nil {
+			log.Fatal("Invalid STATEMENTS_LIMIT, must be an integer: ", err)
+		}
+	}
+	flag.IntVar(&Config.statementsLimit, "statements_limit", Config.statementsLimit, "Number of pg_stat_statements entries to export, 0 to disable (environment variable: STATEMENTS_LIMIT)")
+
 	staleReadThresholdStr := os.Getenv("STALE_READ_THRESHOLD")
 	if staleReadThresholdStr != "" {
 		var err error
@@ -284,25 +1329,59 @@ func main() {
 	}
 	flag.DurationVar(&Config.staleReadThreshold, "stale_read_threshold", time.Second*3, "Time for executing the SQL query before stale data is returned (environment variable: STALE_READ_THRESHOLD)")
 
-	flag.Parse()
+	maxStalenessStr := os.Getenv("MAX_STALENESS")
+	if maxStalenessStr != "" {
+		var err error
+		Config.maxStaleness, err = time.ParseDuration(maxStalenessStr)
+		if err != nil {
+			log.Fatal("Invalid MAX_STALENESS, must be a valid Go duration string: ", err)
+		}
+	}
+	flag.DurationVar(&Config.maxStaleness, "max_staleness", Config.maxStaleness, "Maximum age of cached metrics before they are withheld, 0 to always serve them (environment variable: MAX_STALENESS)")
+
+	Config.sampleTimestamps = os.Getenv("SAMPLE_TIMESTAMPS") == "true"
+	flag.BoolVar(&Config.sampleTimestamps, "sample_timestamps", Config.sampleTimestamps, "Export metrics with the time they were collected at instead of the scrape time (environment variable: SAMPLE_TIMESTAMPS)")
 
-	if _, err := sanitizeIdentifier(Config.dbName); err != nil {
-		log.Fatal("Invalid database name: ", err)
+	unreadyAfterStr := os.Getenv("UNREADY_AFTER")
+	if unreadyAfterStr != "" {
+		var err error
+		Config.unreadyAfter, err = time.ParseDuration(unreadyAfterStr)
+		if err != nil {
+			log.Fatal("Invalid UNREADY_AFTER, must be a valid Go duration string: ", err)
+		}
+	} else {
+		Config.unreadyAfter = time.Duration(1) * time.Minute
 	}
+	flag.DurationVar(&Config.unreadyAfter, "unready_after", Config.unreadyAfter, "Time the database may be unreachable before /-/ready reports unready (environment variable: UNREADY_AFTER)")
+
+	flag.StringVar(&Config.configFile, "config_file", os.Getenv("CONFIG_FILE"), "Path to a YAML file of flag values, reloaded on SIGHUP and POST /-/reload (environment variable: CONFIG_FILE)")
 
-	if Config.dbType != "cockroachdb" && Config.dbType != "postgres" {
-		log.Fatal("Invalid database type. Must be 'cockroachdb' or 'postgres'")
+	Config.enableLifecycle = os.Getenv("ENABLE_LIFECYCLE") == "true"
+	flag.BoolVar(&Config.enableLifecycle, "enable_lifecycle", Config.enableLifecycle, "Enable reloading the configuration file with POST /-/reload (environment variable: ENABLE_LIFECYCLE)")
+
+	flag.StringVar(&Config.webConfigFile, "web_config_file", os.Getenv("WEB_CONFIG_FILE"), "Path to a web configuration file enabling TLS and basic authentication (environment variable: WEB_CONFIG_FILE)")
+
+	flag.Parse()
+
+	if Config.configFile != "" {
+		if err := applyConfigFile(Config.configFile, false); err != nil {
+			log.Fatal("Invalid configuration file: ", err)
+		}
+	} else if err := validateConfig(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
 	}
 
 	if Config.listenAddress == "" {
 		Config.listenAddress = ":9612" // Default port
 	}
-	if Config.connStr == "" || Config.dbName == "" {
+	if Config.connStr == "" || len(databaseNames()) == 0 {
 		log.Fatal("Database connection string and name must be provided via command line arguments or environment variables")
 	}
 
 	cacheMetrics = cache.New(Config.cacheTTL, 10*time.Minute)
 	cacheIndices = cache.New(Config.cacheTTLIndices, 10*time.Minute)
+	cacheBloat = cache.New(Config.cacheTTLBloat, 10*time.Minute)
+	cacheExactRows = cache.New(Config.cacheTTLExactRows, 10*time.Minute)
 
 	log.Printf("Rowdy - CockroachDB/PostgreSQL table rows/size & index statistics "+
 		"exporter for Prometheus. (git:%s version:%s)\n",
@@ -311,12 +1390,32 @@ func main() {
 	// log.Printf("Configuration: %#v\n", Config)
 
 	mux := http.NewServeMux()
+	mux.HandleFunc("/", landingHandler)
 	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/-/healthy", healthyHandler)
+	mux.HandleFunc("/-/ready", readyHandler)
+	mux.HandleFunc("/-/reload", reloadHandler)
+	mux.HandleFunc("/api/v1/tables", tablesHandler)
+	mux.HandleFunc("/api/v1/indexes", indexesHandler)
+
+	// Refresh once at startup, so that rowdy can become ready before the
+	// first scrape.
+	refreshInBackground(dbPool)
 
 	server = &http.Server{
 		Addr:    Config.listenAddress,
 		Handler: mux,
 	}
-	server.ListenAndServe()
+
+	go handleSignals()
+
+	if err := listenAndServe(server); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal("Could not start the server: ", err)
+	}
+
+	// The server is only closed by shutdown, and listenAndServe returns as
+	// soon as it stops accepting connections, while requests are still being
+	// served. Wait for shutdown to finish them and close the connections.
+	<-shutdownDone
 	log.Printf("Exiting.")
 }
@@ -1,18 +1,29 @@
 package main
 
 import (
-	_ "github.com/lib/pq"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
 )
 
 func queryTablesPostgreSQL(db DB, dbName string) (RowScanner, error) {
 	return db.Query(`
         SELECT
-            schemaname AS namespace,
-            relname AS table_name,
-            pg_total_relation_size(schemaname || '.' || relname) AS size,
-            n_live_tup AS rows
+            s.schemaname AS namespace,
+            s.relname AS table_name,
+            pg_total_relation_size(s.relid) AS size,
+            s.n_live_tup AS rows,
+            pg_relation_size(s.relid) AS heap_size,
+            COALESCE(pg_total_relation_size(NULLIF(c.reltoastrelid, 0)), 0) AS toast_size,
+            pg_indexes_size(s.relid) AS indexes_size,
+            COALESCE(p.relname, '') AS parent_table
         FROM
-            pg_stat_user_tables;
+            pg_stat_user_tables s
+            JOIN pg_class c ON c.oid = s.relid
+            LEFT JOIN pg_inherits inh ON inh.inhrelid = s.relid AND c.relispartition
+            LEFT JOIN pg_class p ON p.oid = inh.inhparent;
     `)
 }
 
@@ -26,7 +37,8 @@ func queryIndicesPostgreSQL(db DB, dbName string) (RowScanner, error) {
 			ELSE 'secondary'
 		END AS index_type,
 		ic.indisunique AS is_unique,
-		pg_stat_get_numscans(i.oid) AS stat_total_number_of_reads
+		pg_stat_get_numscans(i.oid) AS stat_total_number_of_reads,
+		pg_relation_size(i.oid) AS size
 	FROM
 		pg_class t, pg_class i, pg_index ic,  pg_namespace n
 	WHERE
@@ -35,3 +47,809 @@ func queryIndicesPostgreSQL(db DB, dbName string) (RowScanner, error) {
 		n.nspname NOT LIKE 'pg_%' AND n.nspname != 'information_schema';
 `)
 }
+
+// queryTableStatsPostgreSQL returns the dead tuple count, vacuum/analyze
+// history, sequential/index scan counters and transaction ID age for every
+// user table. Timestamps are returned as Unix epoch seconds, with 0 meaning
+// "never".
+func queryTableStatsPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	return db.Query(`
+	SELECT
+		s.schemaname AS namespace,
+		s.relname AS table_name,
+		s.n_live_tup,
+		s.n_dead_tup,
+		COALESCE(EXTRACT(EPOCH FROM s.last_vacuum), 0) AS last_vacuum,
+		COALESCE(EXTRACT(EPOCH FROM s.last_autovacuum), 0) AS last_autovacuum,
+		COALESCE(EXTRACT(EPOCH FROM s.last_analyze), 0) AS last_analyze,
+		COALESCE(EXTRACT(EPOCH FROM s.last_autoanalyze), 0) AS last_autoanalyze,
+		s.vacuum_count,
+		s.autovacuum_count,
+		s.analyze_count,
+		s.autoanalyze_count,
+		s.seq_scan,
+		s.seq_tup_read,
+		COALESCE(s.idx_scan, 0) AS idx_scan,
+		COALESCE(s.idx_tup_fetch, 0) AS idx_tup_fetch,
+		age(c.relfrozenxid) AS xid_age,
+		mxid_age(c.relminmxid) AS mxid_age,
+		COALESCE(
+			substring(array_to_string(c.reloptions, ' ') FROM 'autovacuum_freeze_max_age=([0-9]+)')::bigint,
+			current_setting('autovacuum_freeze_max_age')::bigint
+		) - age(c.relfrozenxid) AS xid_freeze_remaining
+	FROM
+		pg_stat_user_tables s
+		JOIN pg_class c ON c.oid = s.relid;
+`)
+}
+
+// connStrPostgreSQL returns connStr, in either URL or key/value form, with its
+// database replaced by dbName.
+func connStrPostgreSQL(connStr, dbName string) (string, error) {
+	if strings.HasPrefix(connStr, "postgres://") || strings.HasPrefix(connStr, "postgresql://") {
+		var err error
+		if connStr, err = pq.ParseURL(connStr); err != nil {
+			return "", err
+		}
+	}
+
+	// The last occurrence of a key wins.
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(dbName)
+	return strings.TrimSpace(connStr + " dbname='" + escaped + "'"), nil
+}
+
+// checkDatabasePostgreSQL returns an error unless db is connected to dbName.
+func checkDatabasePostgreSQL(db DB, dbName string) error {
+	rows, err := db.Query("SELECT current_database() = $1, current_database()", dbName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var matches bool
+	var current string
+	if rows.Next() {
+		if err := rows.Scan(&matches, &current); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !matches {
+		return fmt.Errorf("connected to database %q instead of %q", current, dbName)
+	}
+	return nil
+}
+
+// hasExtensionPostgreSQL reports whether the named extension is installed in
+// the database the connection points at.
+func hasExtensionPostgreSQL(db DB, name string) (bool, error) {
+	rows, err := db.Query(`SELECT count(*) FROM pg_extension WHERE extname = $1`, name)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var count float64
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return false, err
+		}
+	}
+	return count > 0, rows.Err()
+}
+
+// queryTableBloatPostgreSQL returns the real size, estimated wasted bytes and
+// bloat ratio of every user table. When the pgstattuple extension is
+// installed pgstattuple_approx is used, otherwise the size is estimated from
+// the planner statistics in pg_stats and pg_class.
+func queryTableBloatPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	hasPgstattuple, err := hasExtensionPostgreSQL(db, "pgstattuple")
+	if err != nil {
+		return nil, err
+	}
+
+	if hasPgstattuple {
+		return db.Query(`
+	SELECT
+		n.nspname AS schema_name,
+		c.relname AS table_name,
+		s.table_len AS real_size,
+		s.dead_tuple_len + s.approx_free_space AS bloat_size,
+		CASE WHEN s.table_len > 0
+			THEN (s.dead_tuple_len + s.approx_free_space)::float / s.table_len
+			ELSE 0
+		END AS bloat_ratio
+	FROM
+		pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace,
+		LATERAL pgstattuple_approx(c.oid) s
+	WHERE
+		c.relkind IN ('r', 'm') AND
+		n.nspname NOT LIKE 'pg_%' AND n.nspname != 'information_schema';
+`)
+	}
+
+	return db.Query(`
+	SELECT
+		schema_name,
+		table_name,
+		bs * tblpages AS real_size,
+		CASE WHEN tblpages - est_tblpages_ff > 0
+			THEN (tblpages - est_tblpages_ff) * bs
+			ELSE 0
+		END AS bloat_size,
+		CASE WHEN tblpages > 0 AND tblpages - est_tblpages_ff > 0
+			THEN (tblpages - est_tblpages_ff) / tblpages::float
+			ELSE 0
+		END AS bloat_ratio
+	FROM (
+		SELECT
+			ceil(reltuples / ((bs - page_hdr) * fillfactor / (tpl_size * 100))) + ceil(toasttuples / 4) AS est_tblpages_ff,
+			tblpages, bs, schema_name, table_name, is_na
+		FROM (
+			SELECT
+				(4 + tpl_hdr_size + tpl_data_size + (2 * ma)
+					- CASE WHEN tpl_hdr_size % ma = 0 THEN ma ELSE tpl_hdr_size % ma END
+					- CASE WHEN ceil(tpl_data_size)::int % ma = 0 THEN ma ELSE ceil(tpl_data_size)::int % ma END
+				) AS tpl_size,
+				heappages + toastpages AS tblpages,
+				reltuples, toasttuples, bs, page_hdr, schema_name, table_name, fillfactor, is_na
+			FROM (
+				SELECT
+					ns.nspname AS schema_name,
+					tbl.relname AS table_name,
+					tbl.reltuples,
+					tbl.relpages AS heappages,
+					COALESCE(toast.relpages, 0) AS toastpages,
+					COALESCE(toast.reltuples, 0) AS toasttuples,
+					COALESCE(substring(array_to_string(tbl.reloptions, ' ') FROM 'fillfactor=([0-9]+)')::smallint, 100) AS fillfactor,
+					current_setting('block_size')::numeric AS bs,
+					CASE WHEN version() ~ 'mingw32|64-bit|x86_64|ppc64|ia64|amd64' THEN 8 ELSE 4 END AS ma,
+					24 AS page_hdr,
+					23 + CASE WHEN max(COALESCE(s.null_frac, 0)) > 0 THEN (7 + count(s.attname)) / 8 ELSE 0::int END AS tpl_hdr_size,
+					sum((1 - COALESCE(s.null_frac, 0)) * COALESCE(s.avg_width, 0)) AS tpl_data_size,
+					bool_or(att.atttypid = 'pg_catalog.name'::regtype)
+						OR sum(CASE WHEN att.attnum > 0 THEN 1 ELSE 0 END) <> count(s.attname) AS is_na
+				FROM
+					pg_attribute att
+					JOIN pg_class tbl ON att.attrelid = tbl.oid
+					JOIN pg_namespace ns ON ns.oid = tbl.relnamespace
+					LEFT JOIN pg_stats s ON s.schemaname = ns.nspname
+						AND s.tablename = tbl.relname AND s.inherited = false AND s.attname = att.attname
+					LEFT JOIN pg_class toast ON tbl.reltoastrelid = toast.oid
+				WHERE
+					NOT att.attisdropped AND
+					tbl.relkind IN ('r', 'm') AND
+					ns.nspname NOT LIKE 'pg_%' AND ns.nspname != 'information_schema'
+				GROUP BY 1, 2, 3, 4, 5, 6, 7, 8, 9, 10
+			) AS s
+		) AS s2
+	) AS s3
+	WHERE NOT is_na;
+`)
+}
+
+// queryIndexBloatPostgreSQL returns the real size, estimated wasted bytes and
+// bloat ratio of every B-tree index, estimated from the planner statistics.
+func queryIndexBloatPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	return db.Query(`
+	SELECT
+		nspname AS schema_name,
+		tblname AS table_name,
+		idxname AS index_name,
+		CASE WHEN x.indisprimary THEN 'primary' ELSE 'secondary' END AS index_type,
+		x.indisunique AS is_unique,
+		bs * relpages AS real_size,
+		CASE WHEN relpages > est_pages_ff THEN bs * (relpages - est_pages_ff) ELSE 0 END AS bloat_size,
+		CASE WHEN relpages > est_pages_ff THEN (relpages - est_pages_ff)::float / relpages ELSE 0 END AS bloat_ratio
+	FROM (
+		SELECT
+			COALESCE(1 + ceil(reltuples / floor((bs - pageopqdata - pagehdr) * fillfactor / (100 * (4 + nulldatahdrwidth)::float))), 0) AS est_pages_ff,
+			bs, nspname, tblname, idxname, idxoid, relpages, is_na
+		FROM (
+			SELECT
+				bs, nspname, tblname, idxname, idxoid, reltuples, relpages, fillfactor, pagehdr, pageopqdata, is_na,
+				(index_tuple_hdr_bm
+					+ maxalign - CASE WHEN index_tuple_hdr_bm % maxalign = 0 THEN maxalign ELSE index_tuple_hdr_bm % maxalign END
+					+ nulldatawidth + maxalign - CASE
+						WHEN nulldatawidth = 0 THEN 0
+						WHEN nulldatawidth::integer % maxalign = 0 THEN maxalign
+						ELSE nulldatawidth::integer % maxalign
+					END
+				)::numeric AS nulldatahdrwidth
+			FROM (
+				SELECT
+					n.nspname, i.tblname, i.idxname, i.reltuples, i.relpages, i.idxoid, i.fillfactor,
+					current_setting('block_size')::numeric AS bs,
+					CASE WHEN version() ~ 'mingw32|64-bit|x86_64|ppc64|ia64|amd64' THEN 8 ELSE 4 END AS maxalign,
+					24 AS pagehdr,
+					16 AS pageopqdata,
+					CASE WHEN max(COALESCE(s.null_frac, 0)) = 0 THEN 8 ELSE 8 + ((32 + 8 - 1) / 8) END AS index_tuple_hdr_bm,
+					sum((1 - COALESCE(s.null_frac, 0)) * COALESCE(s.avg_width, 1024)) AS nulldatawidth,
+					max(CASE WHEN i.atttypid = 'pg_catalog.name'::regtype THEN 1 ELSE 0 END) > 0 AS is_na
+				FROM (
+					SELECT
+						ct.relname AS tblname, ct.relnamespace, ic.idxname, ic.reltuples, ic.relpages, ic.idxoid, ic.fillfactor,
+						COALESCE(a1.attname, a2.attname) AS attname,
+						COALESCE(a1.atttypid, a2.atttypid) AS atttypid,
+						CASE WHEN a1.attnum IS NULL THEN ic.idxname ELSE ct.relname END AS attrelname
+					FROM (
+						SELECT
+							ci.relname AS idxname, ci.reltuples, ci.relpages, i.indrelid AS tbloid, i.indexrelid AS idxoid,
+							COALESCE(substring(array_to_string(ci.reloptions, ' ') FROM 'fillfactor=([0-9]+)')::smallint, 90) AS fillfactor,
+							string_to_array(textin(int2vectorout(i.indkey)), ' ')::int[] AS indkey,
+							generate_series(1, i.indnatts) AS attpos
+						FROM
+							pg_index i
+							JOIN pg_class ci ON ci.oid = i.indexrelid
+						WHERE
+							ci.relam = (SELECT oid FROM pg_am WHERE amname = 'btree') AND
+							ci.relpages > 0
+					) AS ic
+					JOIN pg_class ct ON ct.oid = ic.tbloid
+					LEFT JOIN pg_attribute a1 ON ic.indkey[ic.attpos] <> 0
+						AND a1.attrelid = ic.tbloid AND a1.attnum = ic.indkey[ic.attpos]
+					LEFT JOIN pg_attribute a2 ON ic.indkey[ic.attpos] = 0
+						AND a2.attrelid = ic.idxoid AND a2.attnum = ic.attpos
+				) i
+				JOIN pg_namespace n ON n.oid = i.relnamespace
+				JOIN pg_stats s ON s.schemaname = n.nspname
+					AND s.tablename = i.attrelname AND s.attname = i.attname
+				WHERE
+					n.nspname NOT LIKE 'pg_%' AND n.nspname != 'information_schema'
+				GROUP BY 1, 2, 3, 4, 5, 6, 7
+			) AS rows_data_stats
+		) AS rows_hdr_pdg_stats
+	) AS relation_stats
+	JOIN pg_index x ON x.indexrelid = relation_stats.idxoid
+	WHERE NOT is_na;
+`)
+}
+
+// queryDatabaseWraparoundPostgreSQL returns the transaction ID and multixact
+// ID age of every database, and how many transactions remain until
+// autovacuum_freeze_max_age forces an anti-wraparound vacuum.
+func queryDatabaseWraparoundPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	return db.Query(`
+	SELECT
+		datname,
+		age(datfrozenxid) AS xid_age,
+		mxid_age(datminmxid) AS mxid_age,
+		current_setting('autovacuum_freeze_max_age')::bigint - age(datfrozenxid) AS xid_freeze_remaining
+	FROM
+		pg_database
+	WHERE
+		datallowconn;
+`)
+}
+
+// serverVersionPostgreSQL returns the server version as an integer, e.g.
+// 150004 for 15.4, so query variants can be chosen by version.
+func serverVersionPostgreSQL(db DB) (int, error) {
+	rows, err := db.Query(`SELECT current_setting('server_version_num')::int`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var version int
+	if rows.Next() {
+		if err := rows.Scan(&version); err != nil {
+			return 0, err
+		}
+	}
+	return version, rows.Err()
+}
+
+// queryStatementsPostgreSQL returns the top limit statements from
+// pg_stat_statements by total execution time, aggregated per query ID, user
+// and database. Times are returned in seconds.
+func queryStatementsPostgreSQL(db DB, dbName string, limit int) (RowScanner, error) {
+	version, err := serverVersionPostgreSQL(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// PostgreSQL 13 split total_time into planning and execution time.
+	totalTime := "total_exec_time"
+	if version < 130000 {
+		totalTime = "total_time"
+	}
+
+	return db.Query(fmt.Sprintf(`
+	SELECT
+		COALESCE(s.queryid::text, '') AS queryid,
+		r.rolname AS user_name,
+		d.datname AS database_name,
+		SUM(s.calls) AS calls,
+		SUM(s.%[1]s) / 1000 AS total_time,
+		CASE WHEN SUM(s.calls) > 0 THEN SUM(s.%[1]s) / SUM(s.calls) / 1000 ELSE 0 END AS mean_time,
+		SUM(s.rows) AS rows,
+		SUM(s.shared_blks_hit) AS shared_blks_hit,
+		SUM(s.shared_blks_read) AS shared_blks_read,
+		SUM(s.temp_blks_read) AS temp_blks_read,
+		SUM(s.temp_blks_written) AS temp_blks_written
+	FROM
+		pg_stat_statements s
+		JOIN pg_roles r ON r.oid = s.userid
+		JOIN pg_database d ON d.oid = s.dbid
+	GROUP BY 1, 2, 3
+	ORDER BY total_time DESC
+	LIMIT $1;
+`, totalTime), limit)
+}
+
+// currentLSNPostgreSQL is the WAL position replication lag is measured
+// against: the insert position on a primary, the receive position on a
+// standby.
+const currentLSNPostgreSQL = `CASE WHEN pg_is_in_recovery()
+			THEN pg_last_wal_receive_lsn()
+			ELSE pg_current_wal_lsn()
+		END`
+
+// queryReplicationPostgreSQL returns the write, flush and replay lag of every
+// standby connected to the server, in bytes and seconds.
+func queryReplicationPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	return db.Query(`
+	SELECT
+		application_name,
+		COALESCE(host(client_addr), '') AS client_addr,
+		COALESCE(pg_wal_lsn_diff(` + currentLSNPostgreSQL + `, write_lsn), 0) AS write_lag_bytes,
+		COALESCE(pg_wal_lsn_diff(` + currentLSNPostgreSQL + `, flush_lsn), 0) AS flush_lag_bytes,
+		COALESCE(pg_wal_lsn_diff(` + currentLSNPostgreSQL + `, replay_lsn), 0) AS replay_lag_bytes,
+		COALESCE(EXTRACT(EPOCH FROM write_lag), 0) AS write_lag_seconds,
+		COALESCE(EXTRACT(EPOCH FROM flush_lag), 0) AS flush_lag_seconds,
+		COALESCE(EXTRACT(EPOCH FROM replay_lag), 0) AS replay_lag_seconds
+	FROM
+		pg_stat_replication;
+`)
+}
+
+// queryReplicationSlotsPostgreSQL returns every replication slot, whether it
+// is active and how much WAL it retains.
+func queryReplicationSlotsPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	version, err := serverVersionPostgreSQL(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// wal_status was added in PostgreSQL 13.
+	walStatus := "''"
+	if version >= 130000 {
+		walStatus = "COALESCE(wal_status, '')"
+	}
+
+	return db.Query(`
+	SELECT
+		slot_name,
+		slot_type,
+		COALESCE(database, '') AS database,
+		active,
+		COALESCE(pg_wal_lsn_diff(` + currentLSNPostgreSQL + `, restart_lsn), 0) AS retained_bytes,
+		` + walStatus + ` AS wal_status
+	FROM
+		pg_replication_slots;
+`)
+}
+
+// queryRecoveryPostgreSQL returns whether the server is a standby and, if so,
+// how long ago the last replayed transaction was committed on the primary.
+func queryRecoveryPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	return db.Query(`
+	SELECT
+		pg_is_in_recovery() AS in_recovery,
+		CASE WHEN pg_is_in_recovery()
+			THEN COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+			ELSE 0
+		END AS replay_lag_seconds;
+`)
+}
+
+// queryLocksPostgreSQL returns, per relation in the current database, the
+// number of lock requests waiting to be granted, the longest wait and the
+// depth of the longest chain of sessions blocking a waiter. Only locks on a
+// relation (relation, page and tuple locks) can be attributed to a table.
+func queryLocksPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	version, err := serverVersionPostgreSQL(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// pg_locks.waitstart was added in PostgreSQL 14, before that the start
+	// of the waiting query is the best approximation.
+	waitStart := "a.query_start"
+	if version >= 140000 {
+		waitStart = "COALESCE(l.waitstart, a.query_start)"
+	}
+
+	return db.Query(`
+	WITH RECURSIVE chain(origin, pid, depth, path) AS (
+		SELECT pid, pid, 0, ARRAY[pid]
+		FROM pg_locks
+		WHERE NOT granted AND relation IS NOT NULL
+		UNION ALL
+		SELECT c.origin, b.blocker, c.depth + 1, c.path || b.blocker
+		FROM chain c, LATERAL unnest(pg_blocking_pids(c.pid)) AS b(blocker)
+		WHERE NOT b.blocker = ANY(c.path)
+	), depths AS (
+		SELECT origin AS pid, max(depth) AS depth
+		FROM chain
+		GROUP BY origin
+	)
+	SELECT
+		n.nspname AS schema_name,
+		c.relname AS table_name,
+		count(*) AS waiting,
+		COALESCE(max(EXTRACT(EPOCH FROM now() - ` + waitStart + `)), 0) AS max_wait_seconds,
+		COALESCE(max(d.depth), 0) AS max_chain_depth
+	FROM
+		pg_locks l
+		JOIN pg_class c ON c.oid = l.relation
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_stat_activity a ON a.pid = l.pid
+		LEFT JOIN depths d ON d.pid = l.pid
+	WHERE
+		NOT l.granted AND
+		l.database = (SELECT oid FROM pg_database WHERE datname = current_database())
+	GROUP BY 1, 2;
+`)
+}
+
+// queryTableIOPostgreSQL returns the number of heap, index and TOAST blocks
+// read from disk and found in shared buffers for every user table.
+func queryTableIOPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	return db.Query(`
+	SELECT
+		schemaname AS namespace,
+		relname AS table_name,
+		COALESCE(heap_blks_read, 0) AS heap_blks_read,
+		COALESCE(heap_blks_hit, 0) AS heap_blks_hit,
+		COALESCE(idx_blks_read, 0) AS idx_blks_read,
+		COALESCE(idx_blks_hit, 0) AS idx_blks_hit,
+		COALESCE(toast_blks_read, 0) AS toast_blks_read,
+		COALESCE(toast_blks_hit, 0) AS toast_blks_hit,
+		COALESCE(tidx_blks_read, 0) AS tidx_blks_read,
+		COALESCE(tidx_blks_hit, 0) AS tidx_blks_hit
+	FROM
+		pg_statio_user_tables;
+`)
+}
+
+// queryIndexIOPostgreSQL returns the number of index blocks read from disk
+// and found in shared buffers for every user index.
+func queryIndexIOPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	return db.Query(`
+	SELECT
+		s.schemaname AS schema_name,
+		s.relname AS table_name,
+		s.indexrelname AS index_name,
+		CASE
+			WHEN ic.indisprimary THEN 'primary'
+			ELSE 'secondary'
+		END AS index_type,
+		ic.indisunique AS is_unique,
+		COALESCE(s.idx_blks_read, 0) AS idx_blks_read,
+		COALESCE(s.idx_blks_hit, 0) AS idx_blks_hit
+	FROM
+		pg_statio_user_indexes s
+		JOIN pg_index ic ON ic.indexrelid = s.indexrelid;
+`)
+}
+
+// queryIndexProblemsPostgreSQL returns invalid indexes, exact duplicates of
+// another index and non-unique indexes whose columns are a prefix of a wider
+// index, together with the index that makes them duplicate or redundant and
+// their size. Indexes only match when their operator classes, collations,
+// sort options and predicates do too; an index with INCLUDE columns is never
+// reported as redundant. Of two duplicates, a primary key is kept over a
+// unique index and a unique index over a plain one, so that dropping the
+// reported index never drops a constraint; otherwise the newer is reported.
+func queryIndexProblemsPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	return db.Query(`
+	WITH idx AS (
+		SELECT
+			i.indexrelid, i.indrelid, i.indisvalid, i.indisunique, c.relam,
+			n.nspname AS schema_name, t.relname AS table_name, c.relname AS index_name,
+			CASE
+				WHEN i.indisprimary THEN 'primary'
+				ELSE 'secondary'
+			END AS index_type,
+			i.indisprimary::int + i.indisunique::int AS keep_rank,
+			i.indnkeyatts,
+			string_to_array(i.indkey::text, ' ') AS indkey,
+			string_to_array(i.indclass::text, ' ') AS indclass,
+			string_to_array(i.indcollation::text, ' ') AS indcollation,
+			string_to_array(i.indoption::text, ' ') AS indoption,
+			COALESCE(pg_get_expr(i.indexprs, i.indrelid), '') AS exprs,
+			COALESCE(pg_get_expr(i.indpred, i.indrelid), '') AS pred,
+			pg_relation_size(i.indexrelid) AS size
+		FROM
+			pg_index i
+			JOIN pg_class c ON c.oid = i.indexrelid
+			JOIN pg_class t ON t.oid = i.indrelid
+			JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE
+			n.nspname NOT LIKE 'pg_%' AND n.nspname != 'information_schema'
+	)
+	SELECT schema_name, table_name, index_name, index_type, indisunique::text,
+		'invalid' AS problem, '' AS related, size
+	FROM idx
+	WHERE NOT indisvalid
+	UNION ALL
+	SELECT a.schema_name, a.table_name, a.index_name, a.index_type, a.indisunique::text,
+		'duplicate', b.index_name, a.size
+	FROM idx a
+	JOIN idx b
+		ON a.indrelid = b.indrelid AND a.relam = b.relam
+		AND (a.keep_rank < b.keep_rank OR (a.keep_rank = b.keep_rank AND a.indexrelid > b.indexrelid))
+		AND a.indnkeyatts = b.indnkeyatts AND a.indkey = b.indkey AND a.indclass = b.indclass
+		AND a.indcollation = b.indcollation AND a.indoption = b.indoption
+		AND a.exprs = b.exprs AND a.pred = b.pred
+	UNION ALL
+	SELECT a.schema_name, a.table_name, a.index_name, a.index_type, a.indisunique::text,
+		'redundant', b.index_name, a.size
+	FROM idx a
+	JOIN idx b
+		ON a.indrelid = b.indrelid AND a.indexrelid != b.indexrelid AND a.relam = b.relam
+		AND NOT a.indisunique AND b.indisvalid
+		AND a.exprs = '' AND b.exprs = '' AND a.pred = b.pred
+		AND array_length(a.indkey, 1) = a.indnkeyatts
+		AND array_length(b.indkey, 1) > a.indnkeyatts
+		AND b.indkey[1:a.indnkeyatts] = a.indkey
+		AND b.indclass[1:a.indnkeyatts] = a.indclass
+		AND b.indcollation[1:a.indnkeyatts] = a.indcollation
+		AND b.indoption[1:a.indnkeyatts] = a.indoption;
+`)
+}
+
+// querySequencesPostgreSQL returns the current value, maximum value and used
+// fraction of every sequence, and for sequences owned by a column (SERIAL and
+// identity columns) how much of the column type's range has been used.
+func querySequencesPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	return db.Query(`
+	SELECT
+		s.schemaname AS schema_name,
+		s.sequencename AS sequence_name,
+		COALESCE(s.last_value, 0) AS current_value,
+		s.max_value,
+		COALESCE(CASE
+			WHEN s.last_value IS NULL THEN 0
+			WHEN s.increment_by > 0 THEN (s.last_value::numeric - s.min_value) / NULLIF(s.max_value::numeric - s.min_value, 0)
+			ELSE (s.max_value::numeric - s.last_value) / NULLIF(s.max_value::numeric - s.min_value, 0)
+		END, 0)::float8 AS used_ratio,
+		COALESCE(tn.nspname, '') AS table_schema,
+		COALESCE(t.relname, '') AS table_name,
+		COALESCE(a.attname, '') AS column_name,
+		CASE a.atttypid
+			WHEN 'int2'::regtype THEN abs(COALESCE(s.last_value, 0))::float8 / 32767
+			WHEN 'int4'::regtype THEN abs(COALESCE(s.last_value, 0))::float8 / 2147483647
+			WHEN 'int8'::regtype THEN abs(COALESCE(s.last_value, 0))::float8 / 9223372036854775807
+			ELSE 0
+		END AS column_used_ratio
+	FROM
+		pg_sequences s
+		JOIN pg_namespace sn ON sn.nspname = s.schemaname
+		JOIN pg_class sc ON sc.relname = s.sequencename AND sc.relnamespace = sn.oid
+		LEFT JOIN pg_depend d ON d.objid = sc.oid
+			AND d.classid = 'pg_class'::regclass AND d.refclassid = 'pg_class'::regclass
+			AND d.deptype IN ('a', 'i')
+		LEFT JOIN pg_class t ON t.oid = d.refobjid
+		LEFT JOIN pg_namespace tn ON tn.oid = t.relnamespace
+		LEFT JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid;
+`)
+}
+
+// queryPartitionedTablesPostgreSQL returns the number of partitions and the
+// aggregated row count and size of every declaratively partitioned table,
+// summed over all leaf partitions of its hierarchy.
+func queryPartitionedTablesPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	version, err := serverVersionPostgreSQL(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// pg_partition_tree was added in PostgreSQL 12.
+	if version < 120000 {
+		return nil, nil
+	}
+
+	return db.Query(`
+	SELECT
+		n.nspname AS namespace,
+		p.relname AS table_name,
+		count(*) AS partitions,
+		COALESCE(sum(s.n_live_tup), 0) AS rows,
+		COALESCE(sum(pg_total_relation_size(t.relid)), 0) AS size
+	FROM
+		pg_class p
+		JOIN pg_namespace n ON n.oid = p.relnamespace,
+		LATERAL pg_partition_tree(p.oid) t
+		LEFT JOIN pg_stat_user_tables s ON s.relid = t.relid
+	WHERE
+		p.relkind = 'p' AND t.isleaf AND
+		n.nspname NOT LIKE 'pg_%' AND n.nspname != 'information_schema'
+	GROUP BY 1, 2;
+`)
+}
+
+// queryDatabaseStatsPostgreSQL returns the transaction, conflict, temporary
+// file and block I/O counters and the size of every database on the server.
+func queryDatabaseStatsPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	return db.Query(`
+	SELECT
+		datname,
+		xact_commit,
+		xact_rollback,
+		deadlocks,
+		conflicts,
+		temp_files,
+		temp_bytes,
+		blks_read,
+		blks_hit,
+		CASE WHEN has_database_privilege(datid, 'CONNECT')
+			THEN pg_database_size(datid)
+			ELSE 0
+		END AS size
+	FROM
+		pg_stat_database
+	WHERE
+		datname IS NOT NULL;
+`)
+}
+
+// queryServerStatsPostgreSQL returns the checkpointer, background writer and
+// WAL counters of the server as name/value rows, choosing the views and
+// columns available in the server version. Times are returned in seconds.
+func queryServerStatsPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	version, err := serverVersionPostgreSQL(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []string
+
+	// PostgreSQL 17 moved the checkpoint counters from pg_stat_bgwriter to
+	// pg_stat_checkpointer and dropped the backend buffer counters.
+	if version >= 170000 {
+		parts = append(parts, `
+	SELECT v.name, v.value FROM pg_stat_checkpointer, LATERAL (VALUES
+		('checkpoints_timed', num_timed::float8),
+		('checkpoints_req', num_requested::float8),
+		('checkpoint_write_time', write_time / 1000),
+		('checkpoint_sync_time', sync_time / 1000),
+		('buffers_checkpoint', buffers_written::float8)
+	) v(name, value)`, `
+	SELECT v.name, v.value FROM pg_stat_bgwriter, LATERAL (VALUES
+		('buffers_clean', buffers_clean::float8),
+		('maxwritten_clean', maxwritten_clean::float8),
+		('buffers_alloc', buffers_alloc::float8)
+	) v(name, value)`)
+	} else {
+		parts = append(parts, `
+	SELECT v.name, v.value FROM pg_stat_bgwriter, LATERAL (VALUES
+		('checkpoints_timed', checkpoints_timed::float8),
+		('checkpoints_req', checkpoints_req::float8),
+		('checkpoint_write_time', checkpoint_write_time / 1000),
+		('checkpoint_sync_time', checkpoint_sync_time / 1000),
+		('buffers_checkpoint', buffers_checkpoint::float8),
+		('buffers_clean', buffers_clean::float8),
+		('maxwritten_clean', maxwritten_clean::float8),
+		('buffers_backend', buffers_backend::float8),
+		('buffers_backend_fsync', buffers_backend_fsync::float8),
+		('buffers_alloc', buffers_alloc::float8)
+	) v(name, value)`)
+	}
+
+	// pg_stat_wal was added in PostgreSQL 14, and its write and sync
+	// counters moved to pg_stat_io in PostgreSQL 18.
+	if version >= 180000 {
+		parts = append(parts, `
+	SELECT v.name, v.value FROM pg_stat_wal, LATERAL (VALUES
+		('wal_records', wal_records::float8),
+		('wal_fpi', wal_fpi::float8),
+		('wal_bytes', wal_bytes::float8),
+		('wal_buffers_full', wal_buffers_full::float8)
+	) v(name, value)`)
+	} else if version >= 140000 {
+		parts = append(parts, `
+	SELECT v.name, v.value FROM pg_stat_wal, LATERAL (VALUES
+		('wal_records', wal_records::float8),
+		('wal_fpi', wal_fpi::float8),
+		('wal_bytes', wal_bytes::float8),
+		('wal_buffers_full', wal_buffers_full::float8),
+		('wal_write', wal_write::float8),
+		('wal_sync', wal_sync::float8),
+		('wal_write_time', wal_write_time / 1000),
+		('wal_sync_time', wal_sync_time / 1000)
+	) v(name, value)`)
+	}
+
+	parts = append(parts, `
+	SELECT 'wal_lsn', COALESCE(pg_wal_lsn_diff(`+currentLSNPostgreSQL+`, '0/0'), 0)::float8`)
+
+	return db.Query(strings.Join(parts, "\n\tUNION ALL") + ";")
+}
+
+// queryActivityPostgreSQL returns the number of client connections per
+// database, user, application, state and wait event type, along with the
+// oldest idle-in-transaction session and oldest open transaction per
+// database and the server's connection limits.
+func queryActivityPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	return db.Query(`
+	SELECT
+		COALESCE(datname, '') AS datname,
+		COALESCE(usename, '') AS usename,
+		COALESCE(application_name, '') AS application_name,
+		COALESCE(state, '') AS state,
+		COALESCE(wait_event_type, '') AS wait_event_type,
+		count(*) AS connections,
+		max(max(CASE WHEN state LIKE 'idle in transaction%'
+			THEN EXTRACT(EPOCH FROM now() - state_change)
+			ELSE 0
+		END)) OVER (PARTITION BY datname) AS idle_in_transaction_max_age,
+		max(max(COALESCE(EXTRACT(EPOCH FROM now() - xact_start), 0))) OVER (PARTITION BY datname) AS oldest_transaction_age,
+		current_setting('max_connections')::float8 AS max_connections,
+		(current_setting('superuser_reserved_connections')::int
+			+ COALESCE(current_setting('reserved_connections', true)::int, 0))::float8 AS reserved_connections
+	FROM
+		pg_stat_activity
+	WHERE
+		backend_type = 'client backend'
+	GROUP BY
+		datname, usename, application_name, state, wait_event_type;
+`)
+}
+
+// queryExactRowCountPostgreSQL counts the rows of a single table. With a
+// samplePercent above zero only that percentage of the table's pages is read
+// using TABLESAMPLE SYSTEM and the count is scaled up accordingly.
+func queryExactRowCountPostgreSQL(ctx context.Context, tx Tx, dbName, schema, table string, samplePercent float64) (RowScanner, error) {
+	relation := pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(table)
+	if samplePercent > 0 {
+		return tx.QueryContext(ctx, fmt.Sprintf(
+			`SELECT count(*) * 100 / $1::float8 FROM %s TABLESAMPLE SYSTEM ($1)`, relation), samplePercent)
+	}
+	return tx.QueryContext(ctx, fmt.Sprintf(`SELECT count(*)::float8 FROM %s`, relation))
+}
+
+// queryIOPostgreSQL returns the I/O operation counts and times from
+// pg_stat_io per backend type, object, context and operation, one row per
+// operation. Operations that are not applicable to a combination are
+// omitted. pg_stat_io was added in PostgreSQL 16, older servers return nil.
+func queryIOPostgreSQL(db DB, dbName string) (RowScanner, error) {
+	version, err := serverVersionPostgreSQL(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if version < 160000 {
+		return nil, nil
+	}
+
+	return db.Query(`
+	SELECT
+		backend_type,
+		object,
+		context,
+		v.operation,
+		v.count::float8 AS count,
+		COALESCE(v.time, 0) / 1000 AS time_seconds,
+		v.time IS NOT NULL AS timed
+	FROM
+		pg_stat_io,
+		LATERAL (VALUES
+			('read', reads, read_time),
+			('write', writes, write_time),
+			('writeback', writebacks, writeback_time),
+			('extend', extends, extend_time),
+			('hit', hits, NULL),
+			('eviction', evictions, NULL),
+			('reuse', reuses, NULL),
+			('fsync', fsyncs, fsync_time)
+		) v(operation, count, time)
+	WHERE
+		v.count IS NOT NULL;
+`)
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"time"
+
 	_ "github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 var (
@@ -34,6 +37,662 @@ var (
 		},
 		[]string{"db", "schema", "table_name"},
 	)
+	tableRowsExactGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_rows_exact",
+			Help: "Exact row count, or TABLESAMPLE estimate, of selected tables",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableHeapSizeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_heap_size",
+			Help: "Disk space consumed by the table data, excluding TOAST and indexes",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableToastSizeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_toast_size",
+			Help: "Disk space consumed by the TOAST table and its index",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableIndexesSizeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_indexes_size",
+			Help: "Disk space consumed by all indexes of the table",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tablePartitionInfoGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_partition_info",
+			Help: "Set to 1 for a table that is a partition of parent_table",
+		},
+		[]string{"db", "schema", "table_name", "parent_table"},
+	)
+	indexSizeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "index_size",
+			Help: "Disk space consumed by the index",
+		},
+		[]string{"db", "schema", "table", "name", "type", "unique"},
+	)
+	partitionedTablePartitionsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "partitioned_table_partitions",
+			Help: "Number of leaf partitions of the partitioned table",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	partitionedTableRowsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "partitioned_table_rows",
+			Help: "Estimated row count summed over all partitions",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	partitionedTableSizeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "partitioned_table_size",
+			Help: "Consumed disk space summed over all partitions",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableDeadRowsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_dead_rows",
+			Help: "Estimated number of dead rows",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableDeadRowsRatioGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_dead_rows_ratio",
+			Help: "Dead rows as a fraction of live and dead rows",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableLastVacuumGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_last_vacuum_timestamp_seconds",
+			Help: "Time of the last manual vacuum, 0 if never",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableLastAutovacuumGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_last_autovacuum_timestamp_seconds",
+			Help: "Time of the last autovacuum, 0 if never",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableLastAnalyzeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_last_analyze_timestamp_seconds",
+			Help: "Time of the last manual analyze, 0 if never",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableLastAutoanalyzeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_last_autoanalyze_timestamp_seconds",
+			Help: "Time of the last autoanalyze, 0 if never",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableVacuumsCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "table_vacuums_total",
+			Help: "Number of manual vacuums",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableAutovacuumsCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "table_autovacuums_total",
+			Help: "Number of autovacuums",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableAnalyzesCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "table_analyzes_total",
+			Help: "Number of manual analyzes",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableAutoanalyzesCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "table_autoanalyzes_total",
+			Help: "Number of autoanalyzes",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableXIDAgeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_xid_age",
+			Help: "Age of the table's oldest unfrozen transaction ID",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableMXIDAgeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_mxid_age",
+			Help: "Age of the table's oldest unfrozen multixact ID",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableXIDFreezeRemainingGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_xid_freeze_remaining",
+			Help: "Transactions left until autovacuum_freeze_max_age forces an anti-wraparound vacuum",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	databaseCommitsCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "database_commits_total",
+			Help: "Number of committed transactions",
+		},
+		[]string{"db"},
+	)
+	databaseRollbacksCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "database_rollbacks_total",
+			Help: "Number of rolled back transactions",
+		},
+		[]string{"db"},
+	)
+	databaseDeadlocksCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "database_deadlocks_total",
+			Help: "Number of deadlocks detected",
+		},
+		[]string{"db"},
+	)
+	databaseConflictsCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "database_conflicts_total",
+			Help: "Number of queries cancelled due to conflicts with recovery",
+		},
+		[]string{"db"},
+	)
+	databaseTempFilesCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "database_temp_files_total",
+			Help: "Number of temporary files created by queries",
+		},
+		[]string{"db"},
+	)
+	databaseTempBytesCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "database_temp_bytes_total",
+			Help: "Total amount of data written to temporary files by queries",
+		},
+		[]string{"db"},
+	)
+	databaseBlocksReadCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "database_blocks_read_total",
+			Help: "Number of blocks read from disk",
+		},
+		[]string{"db"},
+	)
+	databaseBlocksHitCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "database_blocks_hit_total",
+			Help: "Number of blocks found in shared buffers",
+		},
+		[]string{"db"},
+	)
+	databaseSizeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "database_size",
+			Help: "Consumed disk space",
+		},
+		[]string{"db"},
+	)
+	databaseXIDAgeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "database_xid_age",
+			Help: "Age of the database's oldest unfrozen transaction ID",
+		},
+		[]string{"db"},
+	)
+	databaseMXIDAgeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "database_mxid_age",
+			Help: "Age of the database's oldest unfrozen multixact ID",
+		},
+		[]string{"db"},
+	)
+	databaseXIDFreezeRemainingGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "database_xid_freeze_remaining",
+			Help: "Transactions left until autovacuum_freeze_max_age forces an anti-wraparound vacuum",
+		},
+		[]string{"db"},
+	)
+	statementsInstalledGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "statements_extension_installed",
+			Help: "Whether the pg_stat_statements extension is installed",
+		},
+		[]string{"db"},
+	)
+	statementCallsCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "statement_calls_total",
+			Help: "Number of times the statement was executed",
+		},
+		[]string{"db", "user", "queryid"},
+	)
+	statementTimeCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "statement_time_seconds_total",
+			Help: "Total time spent executing the statement",
+		},
+		[]string{"db", "user", "queryid"},
+	)
+	statementMeanTimeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "statement_mean_time_seconds",
+			Help: "Mean time spent executing the statement",
+		},
+		[]string{"db", "user", "queryid"},
+	)
+	statementRowsCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "statement_rows_total",
+			Help: "Total number of rows retrieved or affected by the statement",
+		},
+		[]string{"db", "user", "queryid"},
+	)
+	statementSharedBlksHitCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "statement_shared_blocks_hit_total",
+			Help: "Total number of shared block cache hits by the statement",
+		},
+		[]string{"db", "user", "queryid"},
+	)
+	statementSharedBlksReadCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "statement_shared_blocks_read_total",
+			Help: "Total number of shared blocks read by the statement",
+		},
+		[]string{"db", "user", "queryid"},
+	)
+	statementTempBlksReadCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "statement_temp_blocks_read_total",
+			Help: "Total number of temp blocks read by the statement",
+		},
+		[]string{"db", "user", "queryid"},
+	)
+	statementTempBlksWrittenCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "statement_temp_blocks_written_total",
+			Help: "Total number of temp blocks written by the statement",
+		},
+		[]string{"db", "user", "queryid"},
+	)
+	replicationLagBytesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "replication_lag_bytes",
+			Help: "WAL not yet written, flushed or replayed by the standby",
+		},
+		[]string{"application_name", "client_addr", "stage"},
+	)
+	replicationLagSecondsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "replication_lag_seconds",
+			Help: "Time until recent WAL was written, flushed or replayed by the standby",
+		},
+		[]string{"application_name", "client_addr", "stage"},
+	)
+	replicationSlotActiveGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "replication_slot_active",
+			Help: "Whether a client is currently streaming from the slot",
+		},
+		[]string{"db", "slot_name", "slot_type"},
+	)
+	replicationSlotRetainedBytesGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "replication_slot_retained_wal_bytes",
+			Help: "WAL retained on the server for the slot",
+		},
+		[]string{"db", "slot_name", "slot_type"},
+	)
+	replicationSlotWALStatusGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "replication_slot_wal_status",
+			Help: "Availability of the WAL files claimed by the slot",
+		},
+		[]string{"db", "slot_name", "slot_type", "wal_status"},
+	)
+	recoveryGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "replication_is_standby",
+			Help: "Whether the server is a standby in recovery",
+		},
+	)
+	recoveryReplayLagGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "replication_replay_lag_seconds",
+			Help: "Time since the last replayed transaction was committed on the primary",
+		},
+	)
+	lockWaitingGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "lock_waiting",
+			Help: "Number of lock requests waiting to be granted",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	lockMaxWaitGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "lock_max_wait_seconds",
+			Help: "Longest time a lock request has been waiting",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	lockMaxChainDepthGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "lock_max_blocking_chain_depth",
+			Help: "Length of the longest chain of sessions blocking a waiting lock request",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableBlocksReadCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "table_blocks_read_total",
+			Help: "Number of blocks read from disk",
+		},
+		[]string{"db", "schema", "table_name", "type"},
+	)
+	tableBlocksHitCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "table_blocks_hit_total",
+			Help: "Number of blocks found in shared buffers",
+		},
+		[]string{"db", "schema", "table_name", "type"},
+	)
+	indexBlocksReadCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "index_blocks_read_total",
+			Help: "Number of blocks read from disk",
+		},
+		[]string{"db", "schema", "table", "name", "type", "unique"},
+	)
+	indexBlocksHitCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "index_blocks_hit_total",
+			Help: "Number of blocks found in shared buffers",
+		},
+		[]string{"db", "schema", "table", "name", "type", "unique"},
+	)
+	indexProblemGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "index_problem",
+			Help: "Set to 1 for an index flagged as invalid, duplicate or redundant; related is the index it duplicates or is covered by",
+		},
+		[]string{"db", "schema", "table", "name", "type", "unique", "problem", "related"},
+	)
+	indexProblemSizeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "index_problem_size",
+			Help: "Size of an index flagged in index_problem, when known",
+		},
+		[]string{"db", "schema", "table", "name", "type", "unique"},
+	)
+	sequenceCurrentValueGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sequence_current_value",
+			Help: "Last value returned by the sequence",
+		},
+		[]string{"db", "schema", "sequence"},
+	)
+	sequenceMaxValueGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sequence_max_value",
+			Help: "Maximum value of the sequence",
+		},
+		[]string{"db", "schema", "sequence"},
+	)
+	sequenceUsedRatioGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sequence_used_ratio",
+			Help: "Fraction of the sequence's range that has been used",
+		},
+		[]string{"db", "schema", "sequence"},
+	)
+	sequenceColumnUsedRatioGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sequence_column_used_ratio",
+			Help: "Fraction of the column type's range used by the sequence feeding it",
+		},
+		[]string{"db", "schema", "table_name", "column", "sequence"},
+	)
+	connectionsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "connections",
+			Help: "Number of client connections",
+		},
+		[]string{"db", "user", "application_name", "state", "wait_event_type"},
+	)
+	idleInTransactionMaxAgeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "connections_idle_in_transaction_max_age_seconds",
+			Help: "Longest time a session has been idle in transaction",
+		},
+		[]string{"db"},
+	)
+	oldestTransactionAgeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "connections_oldest_transaction_age_seconds",
+			Help: "Age of the oldest open transaction",
+		},
+		[]string{"db"},
+	)
+	maxConnectionsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "connections_max",
+			Help: "Maximum number of concurrent connections (max_connections)",
+		},
+	)
+	reservedConnectionsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "connections_reserved",
+			Help: "Connections reserved for superusers and roles with pg_use_reserved_connections",
+		},
+	)
+	checkpointerCheckpointsTimedCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "checkpointer_checkpoints_timed_total",
+			Help: "Number of scheduled checkpoints",
+		},
+	)
+	checkpointerCheckpointsRequestedCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "checkpointer_checkpoints_requested_total",
+			Help: "Number of requested checkpoints",
+		},
+	)
+	checkpointerWriteTimeCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "checkpointer_write_time_seconds_total",
+			Help: "Time spent writing checkpoint files to disk",
+		},
+	)
+	checkpointerSyncTimeCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "checkpointer_sync_time_seconds_total",
+			Help: "Time spent synchronizing checkpoint files to disk",
+		},
+	)
+	checkpointerBuffersWrittenCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "checkpointer_buffers_written_total",
+			Help: "Number of buffers written during checkpoints",
+		},
+	)
+	bgwriterBuffersCleanCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "bgwriter_buffers_clean_total",
+			Help: "Number of buffers written by the background writer",
+		},
+	)
+	bgwriterMaxwrittenCleanCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "bgwriter_maxwritten_clean_total",
+			Help: "Number of times the background writer stopped a cleaning scan because it had written too many buffers",
+		},
+	)
+	bgwriterBuffersBackendCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "bgwriter_buffers_backend_total",
+			Help: "Number of buffers written directly by a backend",
+		},
+	)
+	bgwriterBuffersBackendFsyncCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "bgwriter_buffers_backend_fsync_total",
+			Help: "Number of times a backend had to execute its own fsync call",
+		},
+	)
+	bgwriterBuffersAllocCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "bgwriter_buffers_alloc_total",
+			Help: "Number of buffers allocated",
+		},
+	)
+	walRecordsCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "wal_records_total",
+			Help: "Number of WAL records generated",
+		},
+	)
+	walFPICounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "wal_fpi_total",
+			Help: "Number of WAL full page images generated",
+		},
+	)
+	walBytesCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "wal_bytes_total",
+			Help: "Amount of WAL generated",
+		},
+	)
+	walBuffersFullCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "wal_buffers_full_total",
+			Help: "Number of times WAL data was written to disk because WAL buffers became full",
+		},
+	)
+	walWriteCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "wal_write_total",
+			Help: "Number of times WAL buffers were written out to disk",
+		},
+	)
+	walSyncCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "wal_sync_total",
+			Help: "Number of times WAL files were synced to disk",
+		},
+	)
+	walWriteTimeCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "wal_write_time_seconds_total",
+			Help: "Time spent writing WAL buffers to disk",
+		},
+	)
+	walSyncTimeCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "wal_sync_time_seconds_total",
+			Help: "Time spent syncing WAL files to disk",
+		},
+	)
+	walLSNCounter = newCounter(
+		prometheus.CounterOpts{
+			Name: "wal_lsn_bytes_total",
+			Help: "Current WAL write position, or receive position on a standby, in bytes",
+		},
+	)
+	ioOperationsCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "io_operations_total",
+			Help: "Number of I/O operations by backend type, object and context",
+		},
+		[]string{"backend_type", "object", "context", "operation"},
+	)
+	ioTimeCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "io_time_seconds_total",
+			Help: "Time spent in I/O operations by backend type, object and context, requires track_io_timing",
+		},
+		[]string{"backend_type", "object", "context", "operation"},
+	)
+	tableBloatGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_bloat",
+			Help: "Estimated disk space wasted by bloat",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableBloatRatioGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "table_bloat_ratio",
+			Help: "Estimated bloat as a fraction of the table size",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	indexBloatGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "index_bloat",
+			Help: "Estimated disk space wasted by bloat",
+		},
+		[]string{"db", "schema", "table", "name", "type", "unique"},
+	)
+	indexBloatRatioGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "index_bloat_ratio",
+			Help: "Estimated bloat as a fraction of the index size",
+		},
+		[]string{"db", "schema", "table", "name", "type", "unique"},
+	)
+	tableSeqScansCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "table_seq_scans_total",
+			Help: "Number of sequential scans",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableSeqRowsReadCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "table_seq_rows_read_total",
+			Help: "Number of live rows read by sequential scans",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableIndexScansCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "table_index_scans_total",
+			Help: "Number of index scans",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
+	tableIndexRowsFetchedCounter = newCounterVec(
+		prometheus.CounterOpts{
+			Name: "table_index_rows_fetched_total",
+			Help: "Number of live rows fetched by index scans",
+		},
+		[]string{"db", "schema", "table_name"},
+	)
 	queryHistogram = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Name:    "stat_query",
@@ -48,6 +707,146 @@ var (
 			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
 		},
 	)
+	queryHistogramTableStats = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_table_stats",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramDatabaseStats = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_database_stats",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramDatabaseWraparound = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_database_wraparound",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramStatements = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_statements",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramReplication = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_replication",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramReplicationSlots = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_replication_slots",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramRecovery = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_recovery",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramLocks = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_locks",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramTableIO = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_table_io",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramIndexIO = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_index_io",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramIndexProblems = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_index_problems",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramSequences = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_sequences",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramPartitionedTables = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_partitioned_tables",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramServerStats = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_server_stats",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramActivity = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_activity",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramExactRows = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_exact_rows",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramIO = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_io",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramTableBloat = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_table_bloat",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	queryHistogramIndexBloat = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "stat_query_index_bloat",
+			Help:    "Time taken to execute the SQL query",
+			Buckets: prometheus.LinearBuckets(0, 0.2, 10),
+		},
+	)
+	lastRefreshGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "last_successful_refresh_timestamp_seconds",
+			Help: "Unix time of the last successful refresh of a collector from a database",
+		},
+		[]string{"db", "collector"},
+	)
 	queryErrorsCounter = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "stat_error_query",
@@ -62,16 +861,340 @@ var (
 	)
 )
 
+// serverStatsMetrics maps the names queryServerStatsPostgreSQL returns the
+// server-wide checkpointer, background writer and WAL statistics as to their
+// metrics.
+var serverStatsMetrics = map[string]prometheus.Gauge{
+	"checkpoints_timed":     checkpointerCheckpointsTimedCounter,
+	"checkpoints_req":       checkpointerCheckpointsRequestedCounter,
+	"checkpoint_write_time": checkpointerWriteTimeCounter,
+	"checkpoint_sync_time":  checkpointerSyncTimeCounter,
+	"buffers_checkpoint":    checkpointerBuffersWrittenCounter,
+	"buffers_clean":         bgwriterBuffersCleanCounter,
+	"maxwritten_clean":      bgwriterMaxwrittenCleanCounter,
+	"buffers_backend":       bgwriterBuffersBackendCounter,
+	"buffers_backend_fsync": bgwriterBuffersBackendFsyncCounter,
+	"buffers_alloc":         bgwriterBuffersAllocCounter,
+	"wal_records":           walRecordsCounter,
+	"wal_fpi":               walFPICounter,
+	"wal_bytes":             walBytesCounter,
+	"wal_buffers_full":      walBuffersFullCounter,
+	"wal_write":             walWriteCounter,
+	"wal_sync":              walSyncCounter,
+	"wal_write_time":        walWriteTimeCounter,
+	"wal_sync_time":         walSyncTimeCounter,
+	"wal_lsn":               walLSNCounter,
+}
+
+// statementsMetrics have a series per statement in the current top-N, which
+// are deleted once a statement falls out of it.
+var statementsMetrics = []interface {
+	DeleteLabelValues(lvs ...string) bool
+}{
+	statementCallsCounter,
+	statementMeanTimeGauge,
+	statementRowsCounter,
+	statementSharedBlksHitCounter,
+	statementSharedBlksReadCounter,
+	statementTempBlksReadCounter,
+	statementTempBlksWrittenCounter,
+	statementTimeCounter,
+}
+
+// collectorMetrics lists the metrics exported by every collector, by name, so
+// that they can be served with the time they were collected at, withheld once
+// stale and selected per scrape.
+var collectorMetrics = map[string][]prometheus.Collector{
+	"activity": {
+		connectionsGauge,
+		idleInTransactionMaxAgeGauge,
+		maxConnectionsGauge,
+		oldestTransactionAgeGauge,
+		reservedConnectionsGauge,
+	},
+	"database_stats": {
+		databaseBlocksHitCounter,
+		databaseBlocksReadCounter,
+		databaseCommitsCounter,
+		databaseConflictsCounter,
+		databaseDeadlocksCounter,
+		databaseRollbacksCounter,
+		databaseSizeGauge,
+		databaseTempBytesCounter,
+		databaseTempFilesCounter,
+	},
+	"database_wraparound": {
+		databaseMXIDAgeGauge,
+		databaseXIDAgeGauge,
+		databaseXIDFreezeRemainingGauge,
+	},
+	"exact_rows": {
+		tableRowsExactGauge,
+	},
+	"index_bloat": {
+		indexBloatGauge,
+		indexBloatRatioGauge,
+	},
+	"index_io": {
+		indexBlocksHitCounter,
+		indexBlocksReadCounter,
+	},
+	"index_problems": {
+		indexProblemGauge,
+		indexProblemSizeGauge,
+	},
+	"indexes": {
+		indexReadCounter,
+		indexSizeGauge,
+	},
+	"io": {
+		ioOperationsCounter,
+		ioTimeCounter,
+	},
+	"locks": {
+		lockMaxChainDepthGauge,
+		lockMaxWaitGauge,
+		lockWaitingGauge,
+	},
+	"partitioned_tables": {
+		partitionedTablePartitionsGauge,
+		partitionedTableRowsGauge,
+		partitionedTableSizeGauge,
+	},
+	"recovery": {
+		recoveryGauge,
+		recoveryReplayLagGauge,
+	},
+	"replication": {
+		replicationLagBytesGauge,
+		replicationLagSecondsGauge,
+	},
+	"replication_slots": {
+		replicationSlotActiveGauge,
+		replicationSlotRetainedBytesGauge,
+		replicationSlotWALStatusGauge,
+	},
+	"sequences": {
+		sequenceColumnUsedRatioGauge,
+		sequenceCurrentValueGauge,
+		sequenceMaxValueGauge,
+		sequenceUsedRatioGauge,
+	},
+	"server_stats": {
+		bgwriterBuffersAllocCounter,
+		bgwriterBuffersBackendCounter,
+		bgwriterBuffersBackendFsyncCounter,
+		bgwriterBuffersCleanCounter,
+		bgwriterMaxwrittenCleanCounter,
+		checkpointerBuffersWrittenCounter,
+		checkpointerCheckpointsRequestedCounter,
+		checkpointerCheckpointsTimedCounter,
+		checkpointerSyncTimeCounter,
+		checkpointerWriteTimeCounter,
+		walBuffersFullCounter,
+		walBytesCounter,
+		walFPICounter,
+		walLSNCounter,
+		walRecordsCounter,
+		walSyncCounter,
+		walSyncTimeCounter,
+		walWriteCounter,
+		walWriteTimeCounter,
+	},
+	"statements": {
+		statementCallsCounter,
+		statementMeanTimeGauge,
+		statementRowsCounter,
+		statementSharedBlksHitCounter,
+		statementSharedBlksReadCounter,
+		statementTempBlksReadCounter,
+		statementTempBlksWrittenCounter,
+		statementTimeCounter,
+		statementsInstalledGauge,
+	},
+	"table_bloat": {
+		tableBloatGauge,
+		tableBloatRatioGauge,
+	},
+	"table_io": {
+		tableBlocksHitCounter,
+		tableBlocksReadCounter,
+	},
+	"table_stats": {
+		tableAnalyzesCounter,
+		tableAutoanalyzesCounter,
+		tableAutovacuumsCounter,
+		tableDeadRowsGauge,
+		tableDeadRowsRatioGauge,
+		tableIndexRowsFetchedCounter,
+		tableIndexScansCounter,
+		tableLastAnalyzeGauge,
+		tableLastAutoanalyzeGauge,
+		tableLastAutovacuumGauge,
+		tableLastVacuumGauge,
+		tableMXIDAgeGauge,
+		tableSeqRowsReadCounter,
+		tableSeqScansCounter,
+		tableVacuumsCounter,
+		tableXIDAgeGauge,
+		tableXIDFreezeRemainingGauge,
+	},
+	"tables": {
+		tableHeapSizeGauge,
+		tableIndexesSizeGauge,
+		tablePartitionInfoGauge,
+		tableRowsGauge,
+		tableSizeGauge,
+		tableToastSizeGauge,
+	},
+}
+
+// counter exports a cumulative statistic without labels as a counter, like
+// counterVec.
+type counter struct {
+	prometheus.Gauge
+}
+
+func newCounter(opts prometheus.CounterOpts) *counter {
+	return &counter{prometheus.NewGauge(prometheus.GaugeOpts(opts))}
+}
+
+func (c *counter) Collect(ch chan<- prometheus.Metric) {
+	collectAsCounters(c.Gauge, ch)
+}
+
+// counterVec exports cumulative statistics read from the database as
+// counters. The database keeps the totals, so they are set rather than
+// incremented, and only turned into counters when collected.
+type counterVec struct {
+	*prometheus.GaugeVec
+}
+
+func newCounterVec(opts prometheus.CounterOpts, labelNames []string) *counterVec {
+	return &counterVec{prometheus.NewGaugeVec(prometheus.GaugeOpts(opts), labelNames)}
+}
+
+func (v *counterVec) Collect(ch chan<- prometheus.Metric) {
+	collectAsCounters(v.GaugeVec, ch)
+}
+
+// collectAsCounters collects the gauges of c as counters.
+func collectAsCounters(c prometheus.Collector, ch chan<- prometheus.Metric) {
+	gauges := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(gauges)
+		close(gauges)
+	}()
+
+	for gauge := range gauges {
+		ch <- counterMetric{gauge}
+	}
+}
+
+// counterMetric writes a gauge as a counter.
+type counterMetric struct {
+	prometheus.Metric
+}
+
+func (m counterMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	out.Counter = &dto.Counter{Value: out.Gauge.Value}
+	out.Gauge = nil
+	return nil
+}
+
+// freshnessCollector exports the metrics of a collector with the time they
+// were collected at when -sample_timestamps is set, and withholds them once
+// they are older than -max_staleness. The time is looked up per database for
+// metrics with a db label. The metrics of a disabled collector are not
+// exported, so that disabling it on reload drops the values it last
+// collected.
+type freshnessCollector struct {
+	prometheus.Collector
+	key string
+}
+
+func (c *freshnessCollector) Collect(ch chan<- prometheus.Metric) {
+	configMu.RLock()
+	enabled := collectorEnabled(c.key)
+	sampleTimestamps, maxStaleness := Config.sampleTimestamps, Config.maxStaleness
+	configMu.RUnlock()
+
+	if !enabled {
+		return
+	}
+	if !sampleTimestamps && maxStaleness <= 0 {
+		c.Collector.Collect(ch)
+		return
+	}
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		c.Collector.Collect(metrics)
+		close(metrics)
+	}()
+
+	for metric := range metrics {
+		var dbName string
+		var m dto.Metric
+		if err := metric.Write(&m); err == nil {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "db" {
+					dbName = label.GetValue()
+				}
+			}
+		}
+
+		collectedAt := lastRefresh(c.key, dbName)
+		if collectedAt.IsZero() {
+			ch <- metric
+			continue
+		}
+		if maxStaleness > 0 && time.Since(collectedAt) > maxStaleness {
+			continue
+		}
+		if sampleTimestamps {
+			metric = prometheus.NewMetricWithTimestamp(collectedAt, metric)
+		}
+		ch <- metric
+	}
+}
+
 func RegisterPrometheusMetrics() {
 	metrics := []prometheus.Collector{
-		indexReadCounter,
 		info,
+		lastRefreshGauge,
 		queryErrorsCounter,
 		queryHistogram,
+		queryHistogramActivity,
+		queryHistogramDatabaseStats,
+		queryHistogramDatabaseWraparound,
+		queryHistogramExactRows,
+		queryHistogramIO,
+		queryHistogramIndexBloat,
+		queryHistogramIndexIO,
+		queryHistogramIndexProblems,
 		queryHistogramIndices,
+		queryHistogramLocks,
+		queryHistogramPartitionedTables,
+		queryHistogramRecovery,
+		queryHistogramReplication,
+		queryHistogramReplicationSlots,
+		queryHistogramSequences,
+		queryHistogramServerStats,
+		queryHistogramStatements,
+		queryHistogramTableBloat,
+		queryHistogramTableIO,
+		queryHistogramTableStats,
 		queryStaleReadsCounter,
-		tableRowsGauge,
-		tableSizeGauge,
+	}
+
+	for key, collectors := range collectorMetrics {
+		for _, collector := range collectors {
+			metrics = append(metrics, &freshnessCollector{Collector: collector, key: key})
+		}
 	}
 
 	for _, metric := range metrics {
@@ -79,9 +1202,7 @@ func RegisterPrometheusMetrics() {
 	}
 
 	// re-register the metrics
-	prometheus.MustRegister(tableRowsGauge, tableSizeGauge, queryHistogram,
-		queryErrorsCounter, queryStaleReadsCounter, info, indexReadCounter,
-		queryHistogramIndices)
+	prometheus.MustRegister(metrics...)
 
 	// re-apply any required initial states
 	info.WithLabelValues(gitCommit, gitTag).Set(1)